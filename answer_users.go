@@ -0,0 +1,135 @@
+package oidcprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	oidc "github.com/wchiways/answer_connect/internal/oidc"
+)
+
+const answerAPITimeout = 5 * time.Second
+
+var (
+	errAnswerUserNotFound = errors.New("answer user not found")
+	errAnswerTokenMissing = errors.New("answer access token is missing")
+)
+
+type answerUser struct {
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	EMail         string `json:"e_mail"`
+	DisplayName   string `json:"display_name"`
+	LastLoginDate int64  `json:"last_login_date"`
+}
+
+type answerUserService struct {
+	apiURL string
+	client *http.Client
+}
+
+func newAnswerUserService(apiURL string) *answerUserService {
+	return &answerUserService{
+		apiURL: strings.TrimRight(apiURL, "/"),
+		client: &http.Client{Timeout: answerAPITimeout},
+	}
+}
+
+func (s *answerUserService) currentUser(ctx oidc.HTTPContext) (answerUser, error) {
+	user := answerUser{}
+	if err := s.get(ctx, "/user/info", nil, &user); err != nil {
+		return answerUser{}, err
+	}
+	if user.ID == "" {
+		return answerUser{}, errAnswerUserNotFound
+	}
+	return user, nil
+}
+
+func (s *answerUserService) userByUsername(username string) (answerUser, error) {
+	user := answerUser{}
+	if err := s.get(nil, "/personal/user/info", url.Values{"username": {username}}, &user); err != nil {
+		return answerUser{}, err
+	}
+	if user.ID == "" {
+		return answerUser{}, errAnswerUserNotFound
+	}
+	return user, nil
+}
+
+func (s *answerUserService) logout(ctx oidc.HTTPContext) error {
+	return s.get(ctx, "/user/logout", nil, nil)
+}
+
+func (s *answerUserService) get(ctx oidc.HTTPContext, path string, query url.Values, out any) error {
+	endpoint := s.apiURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if ctx != nil {
+		token := answerAccessToken(ctx)
+		if token == "" {
+			return errAnswerTokenMissing
+		}
+		req.Header.Set("Authorization", token)
+		if cookie := ctx.Header("Cookie"); cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errAnswerUserNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("answer api %s returned status %d", path, resp.StatusCode)
+	}
+	body := struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if len(body.Data) == 0 || string(body.Data) == "null" {
+		return errAnswerUserNotFound
+	}
+	return json.Unmarshal(body.Data, out)
+}
+
+func answerAccessToken(ctx oidc.HTTPContext) string {
+	token := ctx.Header("Authorization")
+	if token == "" {
+		token = ctx.Query("Authorization")
+	}
+	return strings.TrimPrefix(strings.TrimSpace(token), "Bearer ")
+}
+
+func (u answerUser) profile(base oidc.UserProfile) oidc.UserProfile {
+	base.ID = u.ID
+	base.Username = u.Username
+	if u.EMail != "" {
+		base.Email = u.EMail
+	}
+	base.Name = u.DisplayName
+	if base.Name == "" {
+		base.Name = u.Username
+	}
+	if u.LastLoginDate > 0 {
+		base.AuthTime = time.Unix(u.LastLoginDate, 0).UTC()
+	}
+	return base
+}
@@ -4,20 +4,46 @@ const (
 	PluginInfoName        = "plugin.answer_oidc_provider.backend.info.name"
 	PluginInfoDescription = "plugin.answer_oidc_provider.backend.info.description"
 
-	ConfigIssuerTitle           = "plugin.answer_oidc_provider.backend.config.issuer.title"
-	ConfigIssuerDescription     = "plugin.answer_oidc_provider.backend.config.issuer.description"
-	ConfigBasePathTitle         = "plugin.answer_oidc_provider.backend.config.base_path.title"
-	ConfigBasePathDescription   = "plugin.answer_oidc_provider.backend.config.base_path.description"
-	ConfigAccessTTLTitle        = "plugin.answer_oidc_provider.backend.config.access_ttl.title"
-	ConfigAccessTTLDescription  = "plugin.answer_oidc_provider.backend.config.access_ttl.description"
-	ConfigIDTTLTitle            = "plugin.answer_oidc_provider.backend.config.id_ttl.title"
-	ConfigIDTTLDescription      = "plugin.answer_oidc_provider.backend.config.id_ttl.description"
-	ConfigRefreshTTLTitle       = "plugin.answer_oidc_provider.backend.config.refresh_ttl.title"
-	ConfigRefreshTTLDescription = "plugin.answer_oidc_provider.backend.config.refresh_ttl.description"
-	ConfigCodeTTLTitle          = "plugin.answer_oidc_provider.backend.config.code_ttl.title"
-	ConfigCodeTTLDescription    = "plugin.answer_oidc_provider.backend.config.code_ttl.description"
-	ConfigPrivateKeyTitle       = "plugin.answer_oidc_provider.backend.config.private_key.title"
-	ConfigPrivateKeyDescription = "plugin.answer_oidc_provider.backend.config.private_key.description"
-	ConfigDefaultScopesTitle    = "plugin.answer_oidc_provider.backend.config.default_scopes.title"
-	ConfigDefaultScopesDesc     = "plugin.answer_oidc_provider.backend.config.default_scopes.description"
+	ConfigIssuerTitle                    = "plugin.answer_oidc_provider.backend.config.issuer.title"
+	ConfigIssuerDescription              = "plugin.answer_oidc_provider.backend.config.issuer.description"
+	ConfigIssuerModeTitle                = "plugin.answer_oidc_provider.backend.config.issuer_mode.title"
+	ConfigIssuerModeDescription          = "plugin.answer_oidc_provider.backend.config.issuer_mode.description"
+	ConfigIssuerModeRoot                 = "plugin.answer_oidc_provider.backend.config.issuer_mode.root"
+	ConfigIssuerModeBasePath             = "plugin.answer_oidc_provider.backend.config.issuer_mode.base_path"
+	ConfigBasePathTitle                  = "plugin.answer_oidc_provider.backend.config.base_path.title"
+	ConfigBasePathDescription            = "plugin.answer_oidc_provider.backend.config.base_path.description"
+	ConfigLoginURLTitle                  = "plugin.answer_oidc_provider.backend.config.login_url.title"
+	ConfigLoginURLDescription            = "plugin.answer_oidc_provider.backend.config.login_url.description"
+	ConfigAccessTTLTitle                 = "plugin.answer_oidc_provider.backend.config.access_ttl.title"
+	ConfigAccessTTLDescription           = "plugin.answer_oidc_provider.backend.config.access_ttl.description"
+	ConfigIDTTLTitle                     = "plugin.answer_oidc_provider.backend.config.id_ttl.title"
+	ConfigIDTTLDescription               = "plugin.answer_oidc_provider.backend.config.id_ttl.description"
+	ConfigRefreshTTLTitle                = "plugin.answer_oidc_provider.backend.config.refresh_ttl.title"
+	ConfigRefreshTTLDescription          = "plugin.answer_oidc_provider.backend.config.refresh_ttl.description"
+	ConfigRefreshMaxLifetimeTitle        = "plugin.answer_oidc_provider.backend.config.refresh_max_lifetime.title"
+	ConfigRefreshMaxLifetimeDescription  = "plugin.answer_oidc_provider.backend.config.refresh_max_lifetime.description"
+	ConfigRefreshGraceTitle              = "plugin.answer_oidc_provider.backend.config.refresh_grace.title"
+	ConfigRefreshGraceDescription        = "plugin.answer_oidc_provider.backend.config.refresh_grace.description"
+	ConfigCodeTTLTitle                   = "plugin.answer_oidc_provider.backend.config.code_ttl.title"
+	ConfigCodeTTLDescription             = "plugin.answer_oidc_provider.backend.config.code_ttl.description"
+	ConfigMaxClientAccessTTLTitle        = "plugin.answer_oidc_provider.backend.config.max_client_access_ttl.title"
+	ConfigMaxClientAccessTTLDescription  = "plugin.answer_oidc_provider.backend.config.max_client_access_ttl.description"
+	ConfigMaxClientIDTTLTitle            = "plugin.answer_oidc_provider.backend.config.max_client_id_ttl.title"
+	ConfigMaxClientIDTTLDescription      = "plugin.answer_oidc_provider.backend.config.max_client_id_ttl.description"
+	ConfigMaxClientRefreshTTLTitle       = "plugin.answer_oidc_provider.backend.config.max_client_refresh_ttl.title"
+	ConfigMaxClientRefreshTTLDescription = "plugin.answer_oidc_provider.backend.config.max_client_refresh_ttl.description"
+	ConfigMaxClientRefreshMaxTitle       = "plugin.answer_oidc_provider.backend.config.max_client_refresh_max_lifetime.title"
+	ConfigMaxClientRefreshMaxDescription = "plugin.answer_oidc_provider.backend.config.max_client_refresh_max_lifetime.description"
+	ConfigMaxClientCodeTTLTitle          = "plugin.answer_oidc_provider.backend.config.max_client_code_ttl.title"
+	ConfigMaxClientCodeTTLDescription    = "plugin.answer_oidc_provider.backend.config.max_client_code_ttl.description"
+	ConfigAccessTokenProfileTitle        = "plugin.answer_oidc_provider.backend.config.access_token_profile.title"
+	ConfigAccessTokenProfileDescription  = "plugin.answer_oidc_provider.backend.config.access_token_profile.description"
+	ConfigAccessTokenProfileLegacy       = "plugin.answer_oidc_provider.backend.config.access_token_profile.legacy"
+	ConfigAccessTokenProfileRFC9068      = "plugin.answer_oidc_provider.backend.config.access_token_profile.rfc9068"
+	ConfigPrivateKeyTitle                = "plugin.answer_oidc_provider.backend.config.private_key.title"
+	ConfigPrivateKeyDescription          = "plugin.answer_oidc_provider.backend.config.private_key.description"
+	ConfigJWKSCacheMaxAgeTitle           = "plugin.answer_oidc_provider.backend.config.jwks_cache_max_age.title"
+	ConfigJWKSCacheMaxAgeDescription     = "plugin.answer_oidc_provider.backend.config.jwks_cache_max_age.description"
+	ConfigDefaultScopesTitle             = "plugin.answer_oidc_provider.backend.config.default_scopes.title"
+	ConfigDefaultScopesDesc              = "plugin.answer_oidc_provider.backend.config.default_scopes.description"
 )
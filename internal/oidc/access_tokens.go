@@ -0,0 +1,44 @@
+package oidc
+
+import (
+	"strings"
+	"time"
+)
+
+func isJWTAccessToken(raw string) bool {
+	return strings.Count(raw, ".") == 2
+}
+
+func validateAccessToken(store Store, tokenService *TokenService, raw string, now time.Time) (TokenClaims, error) {
+	if isJWTAccessToken(raw) {
+		return tokenService.ParseAndValidateAccessToken(raw)
+	}
+	record, err := store.GetAccessToken(raw, now)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := TokenClaims{
+		"iss":       tokenService.Issuer(),
+		"sub":       record.UserID,
+		"aud":       audienceClaim(record.Resources, record.ClientID),
+		"client_id": record.ClientID,
+		"scope":     joinScope(record.Scope),
+		"iat":       record.CreatedAt.Unix(),
+		"exp":       record.ExpiresAt.Unix(),
+		"use":       "access_token",
+	}
+	if len(record.AuthorizationDetails) > 0 {
+		claims["authorization_details"] = record.AuthorizationDetails
+	}
+	return claims, nil
+}
+
+func claimTime(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case float64:
+		return time.Unix(int64(v), 0).UTC(), true
+	case int64:
+		return time.Unix(v, 0).UTC(), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,25 @@
+package oidc
+
+const (
+	acrPassword  = "urn:answer:acr:password"
+	acrFederated = "urn:answer:acr:federated"
+)
+
+func acrForMethods(methods []string) string {
+	for _, method := range methods {
+		if method == "fed" {
+			return acrFederated
+		}
+	}
+	return acrPassword
+}
+
+func selectACR(requested, methods []string) string {
+	achieved := acrForMethods(methods)
+	for _, value := range requested {
+		if value == achieved {
+			return value
+		}
+	}
+	return achieved
+}
@@ -0,0 +1,155 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidAuthorizationDetails = errors.New("authorization_details must be a non-empty JSON array of objects")
+
+func parseAuthorizationDetails(raw string) ([]AuthorizationDetail, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	var details []AuthorizationDetail
+	if err := json.Unmarshal([]byte(raw), &details); err != nil || len(details) == 0 {
+		return nil, ErrInvalidAuthorizationDetails
+	}
+	return details, nil
+}
+
+func validateAuthorizationDetails(store Store, details []AuthorizationDetail) error {
+	for _, detail := range details {
+		if detail == nil {
+			return ErrInvalidAuthorizationDetails
+		}
+		name, _ := detail["type"].(string)
+		if strings.TrimSpace(name) == "" {
+			return errors.New("authorization_details entry is missing type")
+		}
+		detailType, err := store.GetAuthorizationDetailType(name)
+		if err != nil {
+			return fmt.Errorf("authorization_details type %q is not registered", name)
+		}
+		if raw, ok := detail["actions"]; ok {
+			actions, ok := detailStrings(raw)
+			if !ok {
+				return errors.New("authorization_details actions must be an array of strings")
+			}
+			for _, action := range actions {
+				if len(detailType.Actions) > 0 && !containsValue(detailType.Actions, action) {
+					return fmt.Errorf("action %q is not allowed for type %q", action, name)
+				}
+			}
+		}
+		if raw, ok := detail["locations"]; ok {
+			locations, ok := detailStrings(raw)
+			if !ok {
+				return errors.New("authorization_details locations must be an array of strings")
+			}
+			for _, location := range locations {
+				if validateResourceIndicator(location) != nil {
+					return fmt.Errorf("location %q must be an absolute URI", location)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func detailStrings(raw any) ([]string, bool) {
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, false
+	}
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		value, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, value)
+	}
+	return out, true
+}
+
+func authorizationDetailKey(detail AuthorizationDetail) string {
+	encoded, err := json.Marshal(detail)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+func authorizationDetailsSubset(required, granted []AuthorizationDetail) bool {
+	if len(required) == 0 {
+		return true
+	}
+	set := make(map[string]struct{}, len(granted))
+	for _, detail := range granted {
+		set[authorizationDetailKey(detail)] = struct{}{}
+	}
+	for _, detail := range required {
+		if _, ok := set[authorizationDetailKey(detail)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func mergeAuthorizationDetails(base, extra []AuthorizationDetail) []AuthorizationDetail {
+	out := append([]AuthorizationDetail{}, base...)
+	for _, detail := range extra {
+		if !authorizationDetailsSubset([]AuthorizationDetail{detail}, out) {
+			out = append(out, detail)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func describeAuthorizationDetails(store Store, details []AuthorizationDetail) []string {
+	out := make([]string, 0, len(details))
+	for _, detail := range details {
+		name, _ := detail["type"].(string)
+		if detailType, err := store.GetAuthorizationDetailType(name); err == nil && detailType.Name != "" {
+			name = detailType.Name
+		}
+		keys := make([]string, 0, len(detail))
+		for key := range detail {
+			if key != "type" {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		parts := make([]string, 0, len(keys))
+		for _, key := range keys {
+			parts = append(parts, key+": "+describeDetailValue(detail[key]))
+		}
+		if len(parts) > 0 {
+			name += " (" + strings.Join(parts, "; ") + ")"
+		}
+		out = append(out, name)
+	}
+	return out
+}
+
+func describeDetailValue(value any) string {
+	if values, ok := detailStrings(value); ok {
+		return strings.Join(values, ", ")
+	}
+	if text, ok := value.(string); ok {
+		return text
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
@@ -10,24 +10,59 @@ import (
 	answerplugin "github.com/apache/answer/plugin"
 )
 
+const DefaultAPIPrefix = "/answer/api/v1"
+
+const (
+	IssuerModeRoot     = "root"
+	IssuerModeBasePath = "base_path"
+)
+
+const (
+	AccessTokenProfileLegacy  = "legacy"
+	AccessTokenProfileRFC9068 = "rfc9068"
+)
+
 type Config struct {
-	Issuer               string
-	BasePath             string
-	AccessTokenTTL       time.Duration
-	IDTokenTTL           time.Duration
-	RefreshTokenTTL      time.Duration
-	AuthorizationCodeTTL time.Duration
-	PrivateKeyPEM        string
-	DefaultScopes        []string
+	Issuer                  string
+	IssuerMode              string
+	SiteURL                 string
+	APIPrefix               string
+	BasePath                string
+	LoginURL                string
+	AccessTokenTTL          time.Duration
+	IDTokenTTL              time.Duration
+	RefreshTokenTTL         time.Duration
+	RefreshTokenMaxLifetime time.Duration
+	RefreshReuseGrace       time.Duration
+	AuthorizationCodeTTL    time.Duration
+	MaxClientAccessTTL      time.Duration
+	MaxClientIDTTL          time.Duration
+	MaxClientRefreshTTL     time.Duration
+	MaxClientRefreshMax     time.Duration
+	MaxClientCodeTTL        time.Duration
+	AccessTokenProfile      string
+	PrivateKeyPEM           string
+	JWKSCacheMaxAge         time.Duration
+	DefaultScopes           []string
 }
 
 func DefaultConfig() Config {
 	return Config{
+		IssuerMode:           IssuerModeRoot,
+		APIPrefix:            DefaultAPIPrefix,
 		BasePath:             "/api/auth/oidc",
+		LoginURL:             "/users/login",
 		AccessTokenTTL:       10 * time.Minute,
 		IDTokenTTL:           10 * time.Minute,
 		RefreshTokenTTL:      30 * 24 * time.Hour,
 		AuthorizationCodeTTL: 5 * time.Minute,
+		MaxClientAccessTTL:   24 * time.Hour,
+		MaxClientIDTTL:       24 * time.Hour,
+		MaxClientRefreshTTL:  90 * 24 * time.Hour,
+		MaxClientRefreshMax:  365 * 24 * time.Hour,
+		MaxClientCodeTTL:     10 * time.Minute,
+		AccessTokenProfile:   AccessTokenProfileLegacy,
+		JWKSCacheMaxAge:      5 * time.Minute,
 		DefaultScopes:        []string{"openid", "profile", "email"},
 	}
 }
@@ -35,6 +70,15 @@ func DefaultConfig() Config {
 func (c Config) normalize() Config {
 	out := c
 	out.Issuer = strings.TrimRight(strings.TrimSpace(out.Issuer), "/")
+	out.IssuerMode = strings.TrimSpace(out.IssuerMode)
+	if out.IssuerMode != IssuerModeBasePath {
+		out.IssuerMode = IssuerModeRoot
+	}
+	out.SiteURL = strings.TrimRight(strings.TrimSpace(out.SiteURL), "/")
+	out.APIPrefix = strings.TrimRight(strings.TrimSpace(out.APIPrefix), "/")
+	if out.APIPrefix != "" && !strings.HasPrefix(out.APIPrefix, "/") {
+		out.APIPrefix = "/" + out.APIPrefix
+	}
 	if out.BasePath == "" {
 		out.BasePath = "/api/auth/oidc"
 	} else if !strings.HasPrefix(out.BasePath, "/") {
@@ -44,6 +88,10 @@ func (c Config) normalize() Config {
 	if out.BasePath == "" {
 		out.BasePath = "/api/auth/oidc"
 	}
+	out.LoginURL = strings.TrimSpace(out.LoginURL)
+	if out.LoginURL == "" {
+		out.LoginURL = "/users/login"
+	}
 	if out.AccessTokenTTL <= 0 {
 		out.AccessTokenTTL = 10 * time.Minute
 	}
@@ -53,9 +101,37 @@ func (c Config) normalize() Config {
 	if out.RefreshTokenTTL <= 0 {
 		out.RefreshTokenTTL = 30 * 24 * time.Hour
 	}
+	if out.RefreshTokenMaxLifetime < 0 {
+		out.RefreshTokenMaxLifetime = 0
+	}
+	if out.RefreshReuseGrace < 0 {
+		out.RefreshReuseGrace = 0
+	}
 	if out.AuthorizationCodeTTL <= 0 {
 		out.AuthorizationCodeTTL = 5 * time.Minute
 	}
+	if out.MaxClientAccessTTL <= 0 {
+		out.MaxClientAccessTTL = 24 * time.Hour
+	}
+	if out.MaxClientIDTTL <= 0 {
+		out.MaxClientIDTTL = 24 * time.Hour
+	}
+	if out.MaxClientRefreshTTL <= 0 {
+		out.MaxClientRefreshTTL = 90 * 24 * time.Hour
+	}
+	if out.MaxClientRefreshMax <= 0 {
+		out.MaxClientRefreshMax = 365 * 24 * time.Hour
+	}
+	if out.MaxClientCodeTTL <= 0 {
+		out.MaxClientCodeTTL = 10 * time.Minute
+	}
+	out.AccessTokenProfile = strings.TrimSpace(out.AccessTokenProfile)
+	if out.AccessTokenProfile != AccessTokenProfileRFC9068 {
+		out.AccessTokenProfile = AccessTokenProfileLegacy
+	}
+	if out.JWKSCacheMaxAge <= 0 {
+		out.JWKSCacheMaxAge = 5 * time.Minute
+	}
 	if len(out.DefaultScopes) == 0 {
 		out.DefaultScopes = []string{"openid", "profile", "email"}
 	}
@@ -66,19 +142,56 @@ func (c Config) Normalize() Config {
 	return c.normalize()
 }
 
-func (c Config) withFallbackIssuer(siteURL string) Config {
-	out := c.normalize()
-	if out.Issuer == "" {
-		out.Issuer = strings.TrimRight(strings.TrimSpace(siteURL), "/")
+func (c Config) mountURL() string {
+	if c.IssuerMode == IssuerModeBasePath && c.Issuer != "" {
+		return c.Issuer
 	}
-	if out.Issuer == "" {
-		out.Issuer = "http://localhost:8080"
+	return c.answerAPIURL()
+}
+
+func (c Config) siteURL() string {
+	if c.SiteURL == "" {
+		return "http://localhost:8080"
 	}
-	return out
+	return c.SiteURL
 }
 
-func (c Config) WithFallbackIssuer(siteURL string) Config {
-	return c.withFallbackIssuer(siteURL)
+func (c Config) answerAPIURL() string {
+	return c.siteURL() + c.APIPrefix
+}
+
+func (c Config) AnswerAPIURL() string {
+	return c.normalize().answerAPIURL()
+}
+
+func (c Config) issuerURL() string {
+	if c.IssuerMode == IssuerModeBasePath {
+		return c.mountURL() + c.BasePath
+	}
+	if c.Issuer != "" {
+		return c.Issuer
+	}
+	return c.siteURL()
+}
+
+func (c Config) IssuerURL() string {
+	return c.normalize().issuerURL()
+}
+
+func (c Config) endpointURL(path string) string {
+	return c.mountURL() + c.BasePath + path
+}
+
+func (c Config) WithSiteURL(siteURL string) Config {
+	out := c
+	out.SiteURL = siteURL
+	return out.normalize()
+}
+
+func (c Config) WithAPIPrefix(prefix string) Config {
+	out := c
+	out.APIPrefix = prefix
+	return out.normalize()
 }
 
 func (c Config) toPluginConfigFields() []answerplugin.ConfigField {
@@ -95,6 +208,18 @@ func (c Config) toPluginConfigFields() []answerplugin.ConfigField {
 				InputType: answerplugin.InputTypeUrl,
 			},
 		},
+		{
+			Name:        "issuer_mode",
+			Type:        answerplugin.ConfigTypeSelect,
+			Title:       answerplugin.MakeTranslator(oidci18n.ConfigIssuerModeTitle),
+			Description: answerplugin.MakeTranslator(oidci18n.ConfigIssuerModeDescription),
+			Required:    true,
+			Value:       n.IssuerMode,
+			Options: []answerplugin.ConfigFieldOption{
+				{Label: answerplugin.MakeTranslator(oidci18n.ConfigIssuerModeRoot), Value: IssuerModeRoot},
+				{Label: answerplugin.MakeTranslator(oidci18n.ConfigIssuerModeBasePath), Value: IssuerModeBasePath},
+			},
+		},
 		{
 			Name:        "base_path",
 			Type:        answerplugin.ConfigTypeInput,
@@ -106,6 +231,17 @@ func (c Config) toPluginConfigFields() []answerplugin.ConfigField {
 				InputType: answerplugin.InputTypeText,
 			},
 		},
+		{
+			Name:        "login_url",
+			Type:        answerplugin.ConfigTypeInput,
+			Title:       answerplugin.MakeTranslator(oidci18n.ConfigLoginURLTitle),
+			Description: answerplugin.MakeTranslator(oidci18n.ConfigLoginURLDescription),
+			Required:    false,
+			Value:       n.LoginURL,
+			UIOptions: answerplugin.ConfigFieldUIOptions{
+				InputType: answerplugin.InputTypeText,
+			},
+		},
 		{
 			Name:        "access_token_ttl_seconds",
 			Type:        answerplugin.ConfigTypeInput,
@@ -139,6 +275,28 @@ func (c Config) toPluginConfigFields() []answerplugin.ConfigField {
 				InputType: answerplugin.InputTypeNumber,
 			},
 		},
+		{
+			Name:        "refresh_token_max_lifetime_seconds",
+			Type:        answerplugin.ConfigTypeInput,
+			Title:       answerplugin.MakeTranslator(oidci18n.ConfigRefreshMaxLifetimeTitle),
+			Description: answerplugin.MakeTranslator(oidci18n.ConfigRefreshMaxLifetimeDescription),
+			Required:    false,
+			Value:       fmt.Sprintf("%d", int64(n.RefreshTokenMaxLifetime/time.Second)),
+			UIOptions: answerplugin.ConfigFieldUIOptions{
+				InputType: answerplugin.InputTypeNumber,
+			},
+		},
+		{
+			Name:        "refresh_reuse_grace_seconds",
+			Type:        answerplugin.ConfigTypeInput,
+			Title:       answerplugin.MakeTranslator(oidci18n.ConfigRefreshGraceTitle),
+			Description: answerplugin.MakeTranslator(oidci18n.ConfigRefreshGraceDescription),
+			Required:    false,
+			Value:       fmt.Sprintf("%d", int64(n.RefreshReuseGrace/time.Second)),
+			UIOptions: answerplugin.ConfigFieldUIOptions{
+				InputType: answerplugin.InputTypeNumber,
+			},
+		},
 		{
 			Name:        "authorization_code_ttl_seconds",
 			Type:        answerplugin.ConfigTypeInput,
@@ -150,6 +308,73 @@ func (c Config) toPluginConfigFields() []answerplugin.ConfigField {
 				InputType: answerplugin.InputTypeNumber,
 			},
 		},
+		{
+			Name:        "max_client_access_token_ttl_seconds",
+			Type:        answerplugin.ConfigTypeInput,
+			Title:       answerplugin.MakeTranslator(oidci18n.ConfigMaxClientAccessTTLTitle),
+			Description: answerplugin.MakeTranslator(oidci18n.ConfigMaxClientAccessTTLDescription),
+			Required:    false,
+			Value:       fmt.Sprintf("%d", int64(n.MaxClientAccessTTL/time.Second)),
+			UIOptions: answerplugin.ConfigFieldUIOptions{
+				InputType: answerplugin.InputTypeNumber,
+			},
+		},
+		{
+			Name:        "max_client_id_token_ttl_seconds",
+			Type:        answerplugin.ConfigTypeInput,
+			Title:       answerplugin.MakeTranslator(oidci18n.ConfigMaxClientIDTTLTitle),
+			Description: answerplugin.MakeTranslator(oidci18n.ConfigMaxClientIDTTLDescription),
+			Required:    false,
+			Value:       fmt.Sprintf("%d", int64(n.MaxClientIDTTL/time.Second)),
+			UIOptions: answerplugin.ConfigFieldUIOptions{
+				InputType: answerplugin.InputTypeNumber,
+			},
+		},
+		{
+			Name:        "max_client_refresh_token_ttl_seconds",
+			Type:        answerplugin.ConfigTypeInput,
+			Title:       answerplugin.MakeTranslator(oidci18n.ConfigMaxClientRefreshTTLTitle),
+			Description: answerplugin.MakeTranslator(oidci18n.ConfigMaxClientRefreshTTLDescription),
+			Required:    false,
+			Value:       fmt.Sprintf("%d", int64(n.MaxClientRefreshTTL/time.Second)),
+			UIOptions: answerplugin.ConfigFieldUIOptions{
+				InputType: answerplugin.InputTypeNumber,
+			},
+		},
+		{
+			Name:        "max_client_refresh_token_max_lifetime_seconds",
+			Type:        answerplugin.ConfigTypeInput,
+			Title:       answerplugin.MakeTranslator(oidci18n.ConfigMaxClientRefreshMaxTitle),
+			Description: answerplugin.MakeTranslator(oidci18n.ConfigMaxClientRefreshMaxDescription),
+			Required:    false,
+			Value:       fmt.Sprintf("%d", int64(n.MaxClientRefreshMax/time.Second)),
+			UIOptions: answerplugin.ConfigFieldUIOptions{
+				InputType: answerplugin.InputTypeNumber,
+			},
+		},
+		{
+			Name:        "max_client_authorization_code_ttl_seconds",
+			Type:        answerplugin.ConfigTypeInput,
+			Title:       answerplugin.MakeTranslator(oidci18n.ConfigMaxClientCodeTTLTitle),
+			Description: answerplugin.MakeTranslator(oidci18n.ConfigMaxClientCodeTTLDescription),
+			Required:    false,
+			Value:       fmt.Sprintf("%d", int64(n.MaxClientCodeTTL/time.Second)),
+			UIOptions: answerplugin.ConfigFieldUIOptions{
+				InputType: answerplugin.InputTypeNumber,
+			},
+		},
+		{
+			Name:        "access_token_profile",
+			Type:        answerplugin.ConfigTypeSelect,
+			Title:       answerplugin.MakeTranslator(oidci18n.ConfigAccessTokenProfileTitle),
+			Description: answerplugin.MakeTranslator(oidci18n.ConfigAccessTokenProfileDescription),
+			Required:    true,
+			Value:       n.AccessTokenProfile,
+			Options: []answerplugin.ConfigFieldOption{
+				{Label: answerplugin.MakeTranslator(oidci18n.ConfigAccessTokenProfileLegacy), Value: AccessTokenProfileLegacy},
+				{Label: answerplugin.MakeTranslator(oidci18n.ConfigAccessTokenProfileRFC9068), Value: AccessTokenProfileRFC9068},
+			},
+		},
 		{
 			Name:        "private_key_pem",
 			Type:        answerplugin.ConfigTypeTextarea,
@@ -161,6 +386,17 @@ func (c Config) toPluginConfigFields() []answerplugin.ConfigField {
 				Rows: "8",
 			},
 		},
+		{
+			Name:        "jwks_cache_max_age_seconds",
+			Type:        answerplugin.ConfigTypeInput,
+			Title:       answerplugin.MakeTranslator(oidci18n.ConfigJWKSCacheMaxAgeTitle),
+			Description: answerplugin.MakeTranslator(oidci18n.ConfigJWKSCacheMaxAgeDescription),
+			Required:    false,
+			Value:       fmt.Sprintf("%d", int64(n.JWKSCacheMaxAge/time.Second)),
+			UIOptions: answerplugin.ConfigFieldUIOptions{
+				InputType: answerplugin.InputTypeNumber,
+			},
+		},
 		{
 			Name:        "default_scopes",
 			Type:        answerplugin.ConfigTypeInput,
@@ -175,36 +411,61 @@ func (c Config) toPluginConfigFields() []answerplugin.ConfigField {
 	}
 }
 
+func clientLifetime(override, fallback, ceiling time.Duration) time.Duration {
+	if override <= 0 {
+		return fallback
+	}
+	if ceiling > 0 && override > ceiling {
+		return ceiling
+	}
+	return override
+}
+
 func (c Config) ToPluginConfigFields() []answerplugin.ConfigField {
 	return c.toPluginConfigFields()
 }
 
 type configPayload struct {
-	Issuer                   string `json:"issuer"`
-	BasePath                 string `json:"base_path"`
-	AccessTokenTTLSeconds    int64  `json:"access_token_ttl_seconds"`
-	IDTokenTTLSeconds        int64  `json:"id_token_ttl_seconds"`
-	RefreshTokenTTLSeconds   int64  `json:"refresh_token_ttl_seconds"`
-	AuthorizationCodeTTL     int64  `json:"authorization_code_ttl_seconds"`
-	PrivateKeyPEM            string `json:"private_key_pem"`
-	DefaultScopesSpaceJoined string `json:"default_scopes"`
+	Issuer                         string `json:"issuer"`
+	IssuerMode                     string `json:"issuer_mode"`
+	BasePath                       string `json:"base_path"`
+	LoginURL                       string `json:"login_url"`
+	AccessTokenTTLSeconds          int64  `json:"access_token_ttl_seconds"`
+	IDTokenTTLSeconds              int64  `json:"id_token_ttl_seconds"`
+	RefreshTokenTTLSeconds         int64  `json:"refresh_token_ttl_seconds"`
+	RefreshTokenMaxLifetimeSeconds *int64 `json:"refresh_token_max_lifetime_seconds"`
+	RefreshReuseGraceSeconds       *int64 `json:"refresh_reuse_grace_seconds"`
+	AuthorizationCodeTTL           int64  `json:"authorization_code_ttl_seconds"`
+	MaxClientAccessTTLSeconds      int64  `json:"max_client_access_token_ttl_seconds"`
+	MaxClientIDTTLSeconds          int64  `json:"max_client_id_token_ttl_seconds"`
+	MaxClientRefreshTTLSeconds     int64  `json:"max_client_refresh_token_ttl_seconds"`
+	MaxClientRefreshMaxSeconds     int64  `json:"max_client_refresh_token_max_lifetime_seconds"`
+	MaxClientCodeTTLSeconds        int64  `json:"max_client_authorization_code_ttl_seconds"`
+	AccessTokenProfile             string `json:"access_token_profile"`
+	PrivateKeyPEM                  string `json:"private_key_pem"`
+	JWKSCacheMaxAgeSeconds         int64  `json:"jwks_cache_max_age_seconds"`
+	DefaultScopesSpaceJoined       string `json:"default_scopes"`
 }
 
 func parseConfig(data []byte, current Config) (Config, error) {
 	next := current
 	if len(data) == 0 {
-		return next.withFallbackIssuer(""), nil
+		return next.normalize(), nil
 	}
 	payload := configPayload{}
 	if err := json.Unmarshal(data, &payload); err != nil {
 		return Config{}, err
 	}
-	if strings.TrimSpace(payload.Issuer) != "" {
-		next.Issuer = payload.Issuer
+	next.Issuer = payload.Issuer
+	if strings.TrimSpace(payload.IssuerMode) != "" {
+		next.IssuerMode = payload.IssuerMode
 	}
 	if strings.TrimSpace(payload.BasePath) != "" {
 		next.BasePath = payload.BasePath
 	}
+	if strings.TrimSpace(payload.LoginURL) != "" {
+		next.LoginURL = payload.LoginURL
+	}
 	if payload.AccessTokenTTLSeconds > 0 {
 		next.AccessTokenTTL = time.Duration(payload.AccessTokenTTLSeconds) * time.Second
 	}
@@ -214,14 +475,41 @@ func parseConfig(data []byte, current Config) (Config, error) {
 	if payload.RefreshTokenTTLSeconds > 0 {
 		next.RefreshTokenTTL = time.Duration(payload.RefreshTokenTTLSeconds) * time.Second
 	}
+	if payload.RefreshTokenMaxLifetimeSeconds != nil {
+		next.RefreshTokenMaxLifetime = time.Duration(*payload.RefreshTokenMaxLifetimeSeconds) * time.Second
+	}
+	if payload.RefreshReuseGraceSeconds != nil {
+		next.RefreshReuseGrace = time.Duration(*payload.RefreshReuseGraceSeconds) * time.Second
+	}
 	if payload.AuthorizationCodeTTL > 0 {
 		next.AuthorizationCodeTTL = time.Duration(payload.AuthorizationCodeTTL) * time.Second
 	}
+	if payload.MaxClientAccessTTLSeconds > 0 {
+		next.MaxClientAccessTTL = time.Duration(payload.MaxClientAccessTTLSeconds) * time.Second
+	}
+	if payload.MaxClientIDTTLSeconds > 0 {
+		next.MaxClientIDTTL = time.Duration(payload.MaxClientIDTTLSeconds) * time.Second
+	}
+	if payload.MaxClientRefreshTTLSeconds > 0 {
+		next.MaxClientRefreshTTL = time.Duration(payload.MaxClientRefreshTTLSeconds) * time.Second
+	}
+	if payload.MaxClientRefreshMaxSeconds > 0 {
+		next.MaxClientRefreshMax = time.Duration(payload.MaxClientRefreshMaxSeconds) * time.Second
+	}
+	if payload.MaxClientCodeTTLSeconds > 0 {
+		next.MaxClientCodeTTL = time.Duration(payload.MaxClientCodeTTLSeconds) * time.Second
+	}
+	if strings.TrimSpace(payload.AccessTokenProfile) != "" {
+		next.AccessTokenProfile = payload.AccessTokenProfile
+	}
 	next.PrivateKeyPEM = payload.PrivateKeyPEM
+	if payload.JWKSCacheMaxAgeSeconds > 0 {
+		next.JWKSCacheMaxAge = time.Duration(payload.JWKSCacheMaxAgeSeconds) * time.Second
+	}
 	if strings.TrimSpace(payload.DefaultScopesSpaceJoined) != "" {
 		next.DefaultScopes = strings.Fields(payload.DefaultScopesSpaceJoined)
 	}
-	return next.withFallbackIssuer(""), nil
+	return next.normalize(), nil
 }
 
 func ParseConfig(data []byte, current Config) (Config, error) {
@@ -0,0 +1,32 @@
+package oidc
+
+var (
+	supportedResponseTypes            = []string{"code"}
+	supportedResponseModes            = []string{"query", "fragment", "form_post", "query.jwt", "fragment.jwt", "form_post.jwt", "jwt"}
+	supportedGrantTypes               = []string{"authorization_code", "refresh_token", cibaGrantType}
+	supportedAccessTokenFormats       = []string{"jwt", "opaque"}
+	supportedTokenEndpointAuthMethods = []string{"client_secret_post", "none"}
+	supportedIntrospectionAuthMethods = []string{"client_secret_post"}
+	supportedCodeChallengeMethods     = []string{"S256"}
+	supportedSubjectTypes             = []string{"public"}
+	supportedIDTokenSigningAlgs       = []string{"RS256"}
+	supportedAuthorizationSigningAlgs = []string{"RS256"}
+	supportedPromptValues             = []string{"none", "login", "consent"}
+	supportedACRValues                = []string{acrPassword, acrFederated}
+	supportedBackchannelDeliveryModes = []string{"poll"}
+	supportedClaims                   = []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "acr", "amr", "preferred_username", "name", "email", "email_verified"}
+)
+
+const (
+	offlineAccessScope = "offline_access"
+	cibaGrantType      = "urn:openid:params:grant-type:ciba"
+)
+
+func containsValue(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
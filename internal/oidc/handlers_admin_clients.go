@@ -1,37 +1,62 @@
 package oidc
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type AdminClientHandler struct {
-	store Store
+	store  Store
+	config Config
 }
 
-func NewAdminClientHandler(store Store) *AdminClientHandler {
-	return &AdminClientHandler{store: store}
+func NewAdminClientHandler(store Store, config Config) *AdminClientHandler {
+	return &AdminClientHandler{store: store, config: config.normalize()}
 }
 
 type createClientRequest struct {
-	ID                      string   `json:"id"`
-	Name                    string   `json:"name"`
-	RedirectURIs            []string `json:"redirect_uris"`
-	Scopes                  []string `json:"scopes"`
-	GrantTypes              []string `json:"grant_types"`
-	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
-	FirstParty              bool     `json:"first_party"`
-	Secret                  string   `json:"secret"`
+	ID                             string   `json:"id"`
+	Name                           string   `json:"name"`
+	RedirectURIs                   []string `json:"redirect_uris"`
+	RedirectURIPatterns            []string `json:"redirect_uri_patterns"`
+	AllowRedirectPatterns          bool     `json:"allow_redirect_patterns"`
+	Scopes                         []string `json:"scopes"`
+	GrantTypes                     []string `json:"grant_types"`
+	TokenEndpointAuthMethod        string   `json:"token_endpoint_auth_method"`
+	DefaultResponseMode            string   `json:"default_response_mode"`
+	AuthorizationSignedResponseAlg string   `json:"authorization_signed_response_alg"`
+	AccessTokenFormat              string   `json:"access_token_format"`
+	AccessTokenTTLSeconds          int64    `json:"access_token_ttl_seconds"`
+	IDTokenTTLSeconds              int64    `json:"id_token_ttl_seconds"`
+	AuthorizationCodeTTLSeconds    int64    `json:"authorization_code_ttl_seconds"`
+	RefreshTokenTTLSeconds         int64    `json:"refresh_token_ttl_seconds"`
+	RefreshTokenMaxLifetimeSeconds int64    `json:"refresh_token_max_lifetime_seconds"`
+	FirstParty                     bool     `json:"first_party"`
+	RequireNonce                   bool     `json:"require_nonce"`
+	Secret                         string   `json:"secret"`
 }
 
 type updateClientRequest struct {
-	Name                    string   `json:"name"`
-	RedirectURIs            []string `json:"redirect_uris"`
-	Scopes                  []string `json:"scopes"`
-	GrantTypes              []string `json:"grant_types"`
-	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
-	FirstParty              bool     `json:"first_party"`
-	Status                  string   `json:"status"`
+	Name                           string   `json:"name"`
+	RedirectURIs                   []string `json:"redirect_uris"`
+	RedirectURIPatterns            []string `json:"redirect_uri_patterns"`
+	AllowRedirectPatterns          *bool    `json:"allow_redirect_patterns"`
+	Scopes                         []string `json:"scopes"`
+	GrantTypes                     []string `json:"grant_types"`
+	TokenEndpointAuthMethod        string   `json:"token_endpoint_auth_method"`
+	DefaultResponseMode            *string  `json:"default_response_mode"`
+	AuthorizationSignedResponseAlg *string  `json:"authorization_signed_response_alg"`
+	AccessTokenFormat              *string  `json:"access_token_format"`
+	AccessTokenTTLSeconds          *int64   `json:"access_token_ttl_seconds"`
+	IDTokenTTLSeconds              *int64   `json:"id_token_ttl_seconds"`
+	AuthorizationCodeTTLSeconds    *int64   `json:"authorization_code_ttl_seconds"`
+	RefreshTokenTTLSeconds         *int64   `json:"refresh_token_ttl_seconds"`
+	RefreshTokenMaxLifetimeSeconds *int64   `json:"refresh_token_max_lifetime_seconds"`
+	FirstParty                     *bool    `json:"first_party"`
+	RequireNonce                   *bool    `json:"require_nonce"`
+	Status                         string   `json:"status"`
 }
 
 func (h *AdminClientHandler) HandleCreate(ctx HTTPContext) {
@@ -44,16 +69,52 @@ func (h *AdminClientHandler) HandleCreate(ctx HTTPContext) {
 		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "name is required", "admin_client_create")
 		return
 	}
-	client, secret, err := h.store.CreateClient(OIDCClient{
-		ID:                      req.ID,
-		Name:                    strings.TrimSpace(req.Name),
-		RedirectURIs:            req.RedirectURIs,
-		Scopes:                  req.Scopes,
-		GrantTypes:              req.GrantTypes,
-		TokenEndpointAuthMethod: req.TokenEndpointAuthMethod,
-		FirstParty:              req.FirstParty,
-		Status:                  "active",
-	}, req.Secret)
+	if req.DefaultResponseMode != "" && !isSupportedResponseMode(req.DefaultResponseMode) {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "default_response_mode is not supported", "admin_client_create")
+		return
+	}
+	if req.AuthorizationSignedResponseAlg != "" && !isSupportedAuthorizationSigningAlg(req.AuthorizationSignedResponseAlg) {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "authorization_signed_response_alg is not supported", "admin_client_create")
+		return
+	}
+	if req.AccessTokenFormat != "" && !containsValue(supportedAccessTokenFormats, req.AccessTokenFormat) {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "access_token_format is not supported", "admin_client_create")
+		return
+	}
+	if err := validateClientRedirectURIs(req.RedirectURIs, req.TokenEndpointAuthMethod); err != nil {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", err.Error(), "admin_client_create")
+		return
+	}
+	client := OIDCClient{
+		ID:                             req.ID,
+		Name:                           strings.TrimSpace(req.Name),
+		RedirectURIs:                   req.RedirectURIs,
+		RedirectURIPatterns:            req.RedirectURIPatterns,
+		AllowRedirectPatterns:          req.AllowRedirectPatterns,
+		Scopes:                         req.Scopes,
+		GrantTypes:                     req.GrantTypes,
+		TokenEndpointAuthMethod:        req.TokenEndpointAuthMethod,
+		DefaultResponseMode:            req.DefaultResponseMode,
+		AuthorizationSignedResponseAlg: req.AuthorizationSignedResponseAlg,
+		AccessTokenFormat:              req.AccessTokenFormat,
+		AccessTokenTTLSeconds:          req.AccessTokenTTLSeconds,
+		IDTokenTTLSeconds:              req.IDTokenTTLSeconds,
+		AuthorizationCodeTTLSeconds:    req.AuthorizationCodeTTLSeconds,
+		RefreshTokenTTLSeconds:         req.RefreshTokenTTLSeconds,
+		RefreshTokenMaxLifetimeSeconds: req.RefreshTokenMaxLifetimeSeconds,
+		FirstParty:                     req.FirstParty,
+		RequireNonce:                   req.RequireNonce,
+		Status:                         "active",
+	}
+	if err := h.validateLifetimes(client); err != nil {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", err.Error(), "admin_client_create")
+		return
+	}
+	if err := validateRedirectURIPatterns(client.RedirectURIPatterns, client.AllowRedirectPatterns); err != nil {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", err.Error(), "admin_client_create")
+		return
+	}
+	client, secret, err := h.store.CreateClient(client, req.Secret)
 	if err != nil {
 		if err == ErrClientExists {
 			writeOAuthError(ctx, http.StatusConflict, "invalid_request", err.Error(), "admin_client_create")
@@ -68,6 +129,50 @@ func (h *AdminClientHandler) HandleCreate(ctx HTTPContext) {
 	})
 }
 
+func (h *AdminClientHandler) validateLifetimes(client OIDCClient) error {
+	limits := []struct {
+		name    string
+		seconds int64
+		ceiling time.Duration
+	}{
+		{"access_token_ttl_seconds", client.AccessTokenTTLSeconds, h.config.MaxClientAccessTTL},
+		{"id_token_ttl_seconds", client.IDTokenTTLSeconds, h.config.MaxClientIDTTL},
+		{"authorization_code_ttl_seconds", client.AuthorizationCodeTTLSeconds, h.config.MaxClientCodeTTL},
+		{"refresh_token_ttl_seconds", client.RefreshTokenTTLSeconds, h.config.MaxClientRefreshTTL},
+		{"refresh_token_max_lifetime_seconds", client.RefreshTokenMaxLifetimeSeconds, h.config.MaxClientRefreshMax},
+	}
+	for _, limit := range limits {
+		if limit.seconds < 0 {
+			return fmt.Errorf("%s must not be negative", limit.name)
+		}
+		if maxSeconds := int64(limit.ceiling / time.Second); limit.seconds > maxSeconds {
+			return fmt.Errorf("%s must not exceed %d", limit.name, maxSeconds)
+		}
+	}
+	return nil
+}
+
+func lifetimeOverride(current int64, requested *int64) int64 {
+	if requested == nil {
+		return current
+	}
+	return *requested
+}
+
+func boolOverride(current bool, requested *bool) bool {
+	if requested == nil {
+		return current
+	}
+	return *requested
+}
+
+func stringOverride(current string, requested *string) string {
+	if requested == nil {
+		return current
+	}
+	return *requested
+}
+
 func (h *AdminClientHandler) HandleList(ctx HTTPContext) {
 	ctx.JSON(http.StatusOK, map[string]any{"clients": h.store.ListClients()})
 }
@@ -87,16 +192,69 @@ func (h *AdminClientHandler) HandleUpdate(ctx HTTPContext, clientID string) {
 		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "invalid request body", "admin_client_update")
 		return
 	}
-	updated, err := h.store.UpdateClient(OIDCClient{
-		ID:                      clientID,
-		Name:                    strings.TrimSpace(req.Name),
-		RedirectURIs:            req.RedirectURIs,
-		Scopes:                  req.Scopes,
-		GrantTypes:              req.GrantTypes,
-		TokenEndpointAuthMethod: req.TokenEndpointAuthMethod,
-		FirstParty:              req.FirstParty,
-		Status:                  req.Status,
-	})
+	if req.DefaultResponseMode != nil && *req.DefaultResponseMode != "" && !isSupportedResponseMode(*req.DefaultResponseMode) {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "default_response_mode is not supported", "admin_client_update")
+		return
+	}
+	if req.AuthorizationSignedResponseAlg != nil && *req.AuthorizationSignedResponseAlg != "" && !isSupportedAuthorizationSigningAlg(*req.AuthorizationSignedResponseAlg) {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "authorization_signed_response_alg is not supported", "admin_client_update")
+		return
+	}
+	if req.AccessTokenFormat != nil && *req.AccessTokenFormat != "" && !containsValue(supportedAccessTokenFormats, *req.AccessTokenFormat) {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "access_token_format is not supported", "admin_client_update")
+		return
+	}
+	current, err := h.store.GetClient(clientID)
+	if err != nil {
+		writeOAuthError(ctx, http.StatusNotFound, "invalid_request", ErrClientNotFound.Error(), "admin_client_update")
+		return
+	}
+	redirectURIs, authMethod := current.RedirectURIs, current.TokenEndpointAuthMethod
+	if len(req.RedirectURIs) > 0 {
+		redirectURIs = req.RedirectURIs
+	}
+	if req.TokenEndpointAuthMethod != "" {
+		authMethod = req.TokenEndpointAuthMethod
+	}
+	if len(req.RedirectURIs) > 0 || authMethod != current.TokenEndpointAuthMethod {
+		if err = validateClientRedirectURIs(redirectURIs, authMethod); err != nil {
+			writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", err.Error(), "admin_client_update")
+			return
+		}
+	}
+	client := OIDCClient{
+		ID:                             clientID,
+		Name:                           strings.TrimSpace(req.Name),
+		RedirectURIs:                   req.RedirectURIs,
+		RedirectURIPatterns:            current.RedirectURIPatterns,
+		AllowRedirectPatterns:          boolOverride(current.AllowRedirectPatterns, req.AllowRedirectPatterns),
+		Scopes:                         req.Scopes,
+		GrantTypes:                     req.GrantTypes,
+		TokenEndpointAuthMethod:        req.TokenEndpointAuthMethod,
+		DefaultResponseMode:            stringOverride(current.DefaultResponseMode, req.DefaultResponseMode),
+		AuthorizationSignedResponseAlg: stringOverride(current.AuthorizationSignedResponseAlg, req.AuthorizationSignedResponseAlg),
+		AccessTokenFormat:              stringOverride(current.AccessTokenFormat, req.AccessTokenFormat),
+		AccessTokenTTLSeconds:          lifetimeOverride(current.AccessTokenTTLSeconds, req.AccessTokenTTLSeconds),
+		IDTokenTTLSeconds:              lifetimeOverride(current.IDTokenTTLSeconds, req.IDTokenTTLSeconds),
+		AuthorizationCodeTTLSeconds:    lifetimeOverride(current.AuthorizationCodeTTLSeconds, req.AuthorizationCodeTTLSeconds),
+		RefreshTokenTTLSeconds:         lifetimeOverride(current.RefreshTokenTTLSeconds, req.RefreshTokenTTLSeconds),
+		RefreshTokenMaxLifetimeSeconds: lifetimeOverride(current.RefreshTokenMaxLifetimeSeconds, req.RefreshTokenMaxLifetimeSeconds),
+		FirstParty:                     boolOverride(current.FirstParty, req.FirstParty),
+		RequireNonce:                   boolOverride(current.RequireNonce, req.RequireNonce),
+		Status:                         req.Status,
+	}
+	if err := h.validateLifetimes(client); err != nil {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", err.Error(), "admin_client_update")
+		return
+	}
+	if req.RedirectURIPatterns != nil {
+		client.RedirectURIPatterns = req.RedirectURIPatterns
+		if err := validateRedirectURIPatterns(client.RedirectURIPatterns, client.AllowRedirectPatterns); err != nil {
+			writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", err.Error(), "admin_client_update")
+			return
+		}
+	}
+	updated, err := h.store.UpdateClient(client)
 	if err != nil {
 		if err == ErrClientNotFound {
 			writeOAuthError(ctx, http.StatusNotFound, "invalid_request", err.Error(), "admin_client_update")
@@ -3,10 +3,11 @@ package oidc
 import (
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 func TestCreateClient(t *testing.T) {
-	handler := NewAdminClientHandler(NewInMemoryStore())
+	handler := NewAdminClientHandler(NewInMemoryStore(), DefaultConfig())
 	ctx := &fakeContext{bindBody: mustMarshal(t, map[string]any{
 		"name":          "Test Client",
 		"redirect_uris": []string{"https://client.example.com/callback"},
@@ -29,7 +30,7 @@ func TestCreateClient(t *testing.T) {
 
 func TestListClients(t *testing.T) {
 	store := NewInMemoryStore()
-	handler := NewAdminClientHandler(store)
+	handler := NewAdminClientHandler(store, DefaultConfig())
 	if _, _, err := store.CreateClient(OIDCClient{Name: "Client 1", RedirectURIs: []string{"https://client.example.com/callback"}, Scopes: []string{"openid"}}, "secret"); err != nil {
 		t.Fatalf("create client: %v", err)
 	}
@@ -54,7 +55,7 @@ func TestListClients(t *testing.T) {
 
 func TestUpdateClient(t *testing.T) {
 	store := NewInMemoryStore()
-	handler := NewAdminClientHandler(store)
+	handler := NewAdminClientHandler(store, DefaultConfig())
 	client, _, err := store.CreateClient(OIDCClient{
 		ID:           "client_1",
 		Name:         "Client 1",
@@ -85,9 +86,37 @@ func TestUpdateClient(t *testing.T) {
 	}
 }
 
+func TestUpdateClientKeepsOmittedFlags(t *testing.T) {
+	store := NewInMemoryStore()
+	if _, _, err := store.CreateClient(OIDCClient{
+		ID:           "client_1",
+		Name:         "Client 1",
+		RedirectURIs: []string{"https://client.example.com/callback"},
+		FirstParty:   true,
+		RequireNonce: true,
+	}, "secret"); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	handler := NewAdminClientHandler(store, DefaultConfig())
+
+	renamed := &fakeContext{bindBody: mustMarshal(t, map[string]any{"name": "renamed"})}
+	handler.HandleUpdate(renamed, "client_1")
+	client, ok := renamed.jsonBody.(OIDCClient)
+	if renamed.statusCode != 200 || !ok || !client.RequireNonce || !client.FirstParty {
+		t.Fatalf("omitted flags must be kept, got %d %s", renamed.statusCode, mustJSON(renamed.jsonBody))
+	}
+
+	cleared := &fakeContext{bindBody: mustMarshal(t, map[string]any{"require_nonce": false})}
+	handler.HandleUpdate(cleared, "client_1")
+	client, ok = cleared.jsonBody.(OIDCClient)
+	if cleared.statusCode != 200 || !ok || client.RequireNonce || !client.FirstParty || client.Name != "renamed" {
+		t.Fatalf("expected only require_nonce to be cleared, got %d %s", cleared.statusCode, mustJSON(cleared.jsonBody))
+	}
+}
+
 func TestDeleteClient(t *testing.T) {
 	store := NewInMemoryStore()
-	handler := NewAdminClientHandler(store)
+	handler := NewAdminClientHandler(store, DefaultConfig())
 	client, _, err := store.CreateClient(OIDCClient{
 		ID:           "client_1",
 		Name:         "Client 1",
@@ -116,3 +145,277 @@ func mustMarshal(t *testing.T, value any) []byte {
 	}
 	return b
 }
+
+func TestClientLifetimeOverrides(t *testing.T) {
+	store := NewInMemoryStore()
+	config := DefaultConfig()
+	config.MaxClientAccessTTL = time.Hour
+	handler := NewAdminClientHandler(store, config)
+
+	for name, body := range map[string]map[string]any{
+		"negative":      {"name": "Dashboard", "id_token_ttl_seconds": -1},
+		"above maximum": {"name": "Dashboard", "access_token_ttl_seconds": 7200},
+		"code maximum":  {"name": "Dashboard", "authorization_code_ttl_seconds": 3600},
+	} {
+		ctx := &fakeContext{bindBody: mustMarshal(t, body)}
+		handler.HandleCreate(ctx)
+		if ctx.statusCode != 400 {
+			t.Fatalf("%s: expected 400, got %d", name, ctx.statusCode)
+		}
+	}
+
+	created := &fakeContext{bindBody: mustMarshal(t, map[string]any{
+		"id":                       "dashboard",
+		"name":                     "Dashboard",
+		"redirect_uris":            []string{"https://dashboard.example.com/callback"},
+		"scopes":                   []string{"openid"},
+		"access_token_ttl_seconds": 3600,
+	})}
+	handler.HandleCreate(created)
+	if created.statusCode != 201 {
+		t.Fatalf("expected 201, got %d body=%s", created.statusCode, mustJSON(created.jsonBody))
+	}
+
+	updated := &fakeContext{bindBody: mustMarshal(t, map[string]any{"name": "Dashboard", "id_token_ttl_seconds": 300})}
+	handler.HandleUpdate(updated, "dashboard")
+	client, ok := updated.jsonBody.(OIDCClient)
+	if updated.statusCode != 200 || !ok {
+		t.Fatalf("expected 200, got %d body=%s", updated.statusCode, mustJSON(updated.jsonBody))
+	}
+	if client.AccessTokenTTLSeconds != 3600 || client.IDTokenTTLSeconds != 300 {
+		t.Fatalf("unexpected lifetimes: %+v", client)
+	}
+
+	cleared := &fakeContext{bindBody: mustMarshal(t, map[string]any{"name": "Dashboard", "access_token_ttl_seconds": 0})}
+	handler.HandleUpdate(cleared, "dashboard")
+	client, ok = cleared.jsonBody.(OIDCClient)
+	if cleared.statusCode != 200 || !ok {
+		t.Fatalf("expected 200, got %d body=%s", cleared.statusCode, mustJSON(cleared.jsonBody))
+	}
+	if client.AccessTokenTTLSeconds != 0 || client.IDTokenTTLSeconds != 300 {
+		t.Fatalf("expected access token override to be cleared: %+v", client)
+	}
+	stored, err := store.GetClient("dashboard")
+	if err != nil || stored.AccessTokenTTLSeconds != 0 {
+		t.Fatalf("expected stored override to be cleared: %+v err=%v", stored, err)
+	}
+}
+
+func TestClientRefreshLifetimeCeilings(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxClientRefreshTTL = 24 * time.Hour
+	config.MaxClientRefreshMax = 30 * 24 * time.Hour
+	handler := NewAdminClientHandler(NewInMemoryStore(), config)
+
+	for name, tc := range map[string]struct {
+		body   map[string]any
+		status int
+	}{
+		"absolute above idle cap":     {map[string]any{"refresh_token_max_lifetime_seconds": 7 * 24 * 3600}, 201},
+		"absolute above its own cap":  {map[string]any{"refresh_token_max_lifetime_seconds": 31 * 24 * 3600}, 400},
+		"idle above idle cap":         {map[string]any{"refresh_token_ttl_seconds": 2 * 24 * 3600}, 400},
+		"idle and absolute in bounds": {map[string]any{"refresh_token_ttl_seconds": 3600, "refresh_token_max_lifetime_seconds": 86400}, 201},
+	} {
+		tc.body["name"] = "Dashboard"
+		tc.body["redirect_uris"] = []string{"https://dashboard.example.com/callback"}
+		ctx := &fakeContext{bindBody: mustMarshal(t, tc.body)}
+		handler.HandleCreate(ctx)
+		if ctx.statusCode != tc.status {
+			t.Fatalf("%s: expected %d, got %d body=%s", name, tc.status, ctx.statusCode, mustJSON(ctx.jsonBody))
+		}
+	}
+}
+
+func TestClientNativeRedirectURIRegistration(t *testing.T) {
+	store := NewInMemoryStore()
+	handler := NewAdminClientHandler(store, DefaultConfig())
+
+	for name, body := range map[string]map[string]any{
+		"localhost":           {"name": "CLI", "token_endpoint_auth_method": "none", "redirect_uris": []string{"http://localhost/callback"}},
+		"confidential scheme": {"name": "App", "redirect_uris": []string{"com.example.app:/callback"}},
+		"script scheme":       {"name": "App", "token_endpoint_auth_method": "none", "redirect_uris": []string{"javascript:alert(1)"}},
+		"fragment":            {"name": "App", "redirect_uris": []string{"https://client.example.com/cb#x"}},
+	} {
+		ctx := &fakeContext{bindBody: mustMarshal(t, body)}
+		handler.HandleCreate(ctx)
+		if ctx.statusCode != 400 {
+			t.Fatalf("%s: expected 400, got %d", name, ctx.statusCode)
+		}
+	}
+
+	created := &fakeContext{bindBody: mustMarshal(t, map[string]any{
+		"id":                         "native_1",
+		"name":                       "Mobile App",
+		"token_endpoint_auth_method": "none",
+		"redirect_uris":              []string{"com.example.app:/callback", "http://127.0.0.1/callback"},
+	})}
+	handler.HandleCreate(created)
+	if created.statusCode != 201 {
+		t.Fatalf("expected 201, got %d body=%s", created.statusCode, mustJSON(created.jsonBody))
+	}
+	promoted := &fakeContext{bindBody: mustMarshal(t, map[string]any{"name": "Mobile App", "token_endpoint_auth_method": "client_secret_post"})}
+	handler.HandleUpdate(promoted, "native_1")
+	if promoted.statusCode != 400 {
+		t.Fatalf("switching to a confidential client must re-check private-use redirect URIs, got %d", promoted.statusCode)
+	}
+}
+
+func TestUpdateLegacyRedirectURIClient(t *testing.T) {
+	store := NewInMemoryStore()
+	if _, _, err := store.CreateClient(OIDCClient{
+		ID:                      "legacy_1",
+		Name:                    "Legacy App",
+		RedirectURIs:            []string{"http://localhost:3000/cb"},
+		TokenEndpointAuthMethod: "client_secret_post",
+		Status:                  "active",
+	}, "secret"); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	handler := NewAdminClientHandler(store, DefaultConfig())
+
+	for _, body := range []map[string]any{{"name": "Renamed App"}, {"status": "disabled"}} {
+		ctx := &fakeContext{bindBody: mustMarshal(t, body)}
+		handler.HandleUpdate(ctx, "legacy_1")
+		if ctx.statusCode != 200 {
+			t.Fatalf("%v: expected 200, got %d body=%s", body, ctx.statusCode, mustJSON(ctx.jsonBody))
+		}
+	}
+	client, err := store.GetClient("legacy_1")
+	if err != nil || client.Status != "disabled" || client.Name != "Renamed App" || client.RedirectURIs[0] != "http://localhost:3000/cb" {
+		t.Fatalf("unexpected client after update: %+v err=%v", client, err)
+	}
+
+	replaced := &fakeContext{bindBody: mustMarshal(t, map[string]any{"redirect_uris": []string{"http://localhost:4000/cb"}})}
+	handler.HandleUpdate(replaced, "legacy_1")
+	if replaced.statusCode != 400 {
+		t.Fatalf("new localhost redirect URIs must still be rejected, got %d", replaced.statusCode)
+	}
+}
+
+func TestClientRedirectURIPatternRegistration(t *testing.T) {
+	handler := NewAdminClientHandler(NewInMemoryStore(), DefaultConfig())
+
+	for _, pattern := range []string{
+		"https://*.com/callback",
+		"https://*.co.uk/callback",
+		"https://*.github.io/callback",
+		"https://pr-*.preview.example.com/callback",
+		"https://*.*.example.com/callback",
+		"https://example.*/callback",
+		"http://*.preview.example.com/callback",
+		"https://*.preview.example.com/callback/*",
+		"https://*.preview.example.com",
+		"https://*.127.0.0.1/callback",
+		"https://*.preview.example.com@evil.com/callback",
+		"https://*.preview.example.com/callback#frag",
+		"https://*.preview%2eexample.com/callback",
+	} {
+		ctx := &fakeContext{bindBody: mustMarshal(t, map[string]any{
+			"name":                    "Preview",
+			"allow_redirect_patterns": true,
+			"redirect_uri_patterns":   []string{pattern},
+		})}
+		handler.HandleCreate(ctx)
+		if ctx.statusCode != 400 {
+			t.Fatalf("%s: expected 400, got %d", pattern, ctx.statusCode)
+		}
+	}
+
+	gated := &fakeContext{bindBody: mustMarshal(t, map[string]any{
+		"name":                  "Preview",
+		"redirect_uri_patterns": []string{"https://*.preview.example.com/callback"},
+	})}
+	handler.HandleCreate(gated)
+	if gated.statusCode != 400 {
+		t.Fatalf("patterns without allow_redirect_patterns must be rejected, got %d", gated.statusCode)
+	}
+
+	created := &fakeContext{bindBody: mustMarshal(t, map[string]any{
+		"name":                    "Preview",
+		"allow_redirect_patterns": true,
+		"redirect_uri_patterns":   []string{"https://*.preview.example.com/callback"},
+	})}
+	handler.HandleCreate(created)
+	if created.statusCode != 201 {
+		t.Fatalf("expected 201, got %d body=%s", created.statusCode, mustJSON(created.jsonBody))
+	}
+	client := created.jsonBody.(map[string]any)["client"].(OIDCClient)
+	if !client.AllowRedirectPatterns || len(client.RedirectURIPatterns) != 1 {
+		t.Fatalf("unexpected client: %+v", client)
+	}
+}
+
+func TestUpdateClientRedirectURIPatterns(t *testing.T) {
+	store := NewInMemoryStore()
+	if _, _, err := store.CreateClient(OIDCClient{
+		ID:                    "preview_1",
+		Name:                  "Preview",
+		RedirectURIs:          []string{"https://app.example.com/callback"},
+		RedirectURIPatterns:   []string{"https://*.preview.example.com/callback"},
+		AllowRedirectPatterns: true,
+	}, "secret"); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	handler := NewAdminClientHandler(store, DefaultConfig())
+	update := func(body map[string]any) OIDCClient {
+		t.Helper()
+		ctx := &fakeContext{bindBody: mustMarshal(t, body)}
+		handler.HandleUpdate(ctx, "preview_1")
+		client, ok := ctx.jsonBody.(OIDCClient)
+		if ctx.statusCode != 200 || !ok {
+			t.Fatalf("%v: expected 200, got %d body=%s", body, ctx.statusCode, mustJSON(ctx.jsonBody))
+		}
+		return client
+	}
+
+	if client := update(map[string]any{"name": "renamed"}); !client.AllowRedirectPatterns || len(client.RedirectURIPatterns) != 1 {
+		t.Fatalf("omitted pattern fields must be kept: %+v", client)
+	}
+	if client := update(map[string]any{"allow_redirect_patterns": false}); client.AllowRedirectPatterns || len(client.RedirectURIPatterns) != 1 {
+		t.Fatalf("expected patterns to be switched off but kept: %+v", client)
+	}
+	if client := update(map[string]any{"redirect_uri_patterns": []string{}}); len(client.RedirectURIPatterns) != 0 {
+		t.Fatalf("expected an empty list to clear the patterns: %+v", client)
+	}
+	if stored, err := store.GetClient("preview_1"); err != nil || len(stored.RedirectURIPatterns) != 0 || stored.AllowRedirectPatterns {
+		t.Fatalf("unexpected stored client: %+v err=%v", stored, err)
+	}
+}
+
+func TestUpdateClientClearsResponseSettings(t *testing.T) {
+	store := NewInMemoryStore()
+	if _, _, err := store.CreateClient(OIDCClient{
+		ID:                             "client_1",
+		Name:                           "Client 1",
+		RedirectURIs:                   []string{"https://client.example.com/callback"},
+		DefaultResponseMode:            "form_post",
+		AuthorizationSignedResponseAlg: "RS256",
+		AccessTokenFormat:              "opaque",
+	}, "secret"); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	handler := NewAdminClientHandler(store, DefaultConfig())
+	update := func(body map[string]any) OIDCClient {
+		t.Helper()
+		ctx := &fakeContext{bindBody: mustMarshal(t, body)}
+		handler.HandleUpdate(ctx, "client_1")
+		client, ok := ctx.jsonBody.(OIDCClient)
+		if ctx.statusCode != 200 || !ok {
+			t.Fatalf("%v: expected 200, got %d body=%s", body, ctx.statusCode, mustJSON(ctx.jsonBody))
+		}
+		return client
+	}
+
+	if client := update(map[string]any{"name": "renamed"}); client.DefaultResponseMode != "form_post" || client.AuthorizationSignedResponseAlg != "RS256" || client.AccessTokenFormat != "opaque" {
+		t.Fatalf("omitted settings must be kept: %+v", client)
+	}
+	if client := update(map[string]any{"default_response_mode": ""}); client.DefaultResponseMode != "" || client.AuthorizationSignedResponseAlg != "RS256" {
+		t.Fatalf("expected default_response_mode to be cleared: %+v", client)
+	}
+	if client := update(map[string]any{"authorization_signed_response_alg": ""}); client.AuthorizationSignedResponseAlg != "" {
+		t.Fatalf("expected authorization_signed_response_alg to be cleared: %+v", client)
+	}
+	if client := update(map[string]any{"access_token_format": ""}); client.AccessTokenFormat != "" {
+		t.Fatalf("expected access_token_format to be cleared: %+v", client)
+	}
+}
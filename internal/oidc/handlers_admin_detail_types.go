@@ -0,0 +1,66 @@
+package oidc
+
+import (
+	"net/http"
+	"strings"
+)
+
+type AdminDetailTypeHandler struct {
+	store Store
+}
+
+func NewAdminDetailTypeHandler(store Store) *AdminDetailTypeHandler {
+	return &AdminDetailTypeHandler{store: store}
+}
+
+type saveDetailTypeRequest struct {
+	Type        string   `json:"type"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Actions     []string `json:"actions"`
+}
+
+func (h *AdminDetailTypeHandler) HandleList(ctx HTTPContext) {
+	ctx.JSON(http.StatusOK, map[string]any{"types": h.store.ListAuthorizationDetailTypes()})
+}
+
+func (h *AdminDetailTypeHandler) HandleSave(ctx HTTPContext) {
+	var req saveDetailTypeRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "invalid request body", "admin_detail_type_save")
+		return
+	}
+	name := strings.TrimSpace(req.Type)
+	if name == "" || strings.ContainsAny(name, " \t\r\n") {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "type is required and must not contain whitespace", "admin_detail_type_save")
+		return
+	}
+	detailType, err := h.store.SaveAuthorizationDetailType(AuthorizationDetailType{
+		Type:        name,
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		Actions:     req.Actions,
+	})
+	if err != nil {
+		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to save authorization details type", "admin_detail_type_save")
+		return
+	}
+	ctx.JSON(http.StatusOK, detailType)
+}
+
+func (h *AdminDetailTypeHandler) HandleDelete(ctx HTTPContext) {
+	name := strings.TrimSpace(ctx.Query("type"))
+	if name == "" {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "type is required", "admin_detail_type_delete")
+		return
+	}
+	if err := h.store.DeleteAuthorizationDetailType(name); err != nil {
+		if err == ErrDetailTypeNotFound {
+			writeOAuthError(ctx, http.StatusNotFound, "invalid_request", err.Error(), "admin_detail_type_delete")
+			return
+		}
+		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to delete authorization details type", "admin_detail_type_delete")
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
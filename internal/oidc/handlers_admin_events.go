@@ -0,0 +1,15 @@
+package oidc
+
+import "net/http"
+
+type AdminEventHandler struct {
+	store Store
+}
+
+func NewAdminEventHandler(store Store) *AdminEventHandler {
+	return &AdminEventHandler{store: store}
+}
+
+func (h *AdminEventHandler) HandleList(ctx HTTPContext) {
+	ctx.JSON(http.StatusOK, map[string]any{"events": h.store.ListSecurityEvents()})
+}
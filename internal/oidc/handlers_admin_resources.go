@@ -0,0 +1,78 @@
+package oidc
+
+import (
+	"net/http"
+	"strings"
+)
+
+type AdminResourceHandler struct {
+	store Store
+}
+
+func NewAdminResourceHandler(store Store) *AdminResourceHandler {
+	return &AdminResourceHandler{store: store}
+}
+
+type saveResourceRequest struct {
+	URI      string   `json:"uri"`
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+	ClientID string   `json:"client_id"`
+}
+
+func (h *AdminResourceHandler) HandleList(ctx HTTPContext) {
+	ctx.JSON(http.StatusOK, map[string]any{"resources": h.store.ListResources()})
+}
+
+func (h *AdminResourceHandler) HandleSave(ctx HTTPContext) {
+	var req saveResourceRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "invalid request body", "admin_resource_save")
+		return
+	}
+	uri := strings.TrimSpace(req.URI)
+	if err := validateResourceIndicator(uri); err != nil {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "uri must be an absolute URI without a fragment", "admin_resource_save")
+		return
+	}
+	if len(normalizeScopes(req.Scopes)) == 0 {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "scopes are required", "admin_resource_save")
+		return
+	}
+	clientID := strings.TrimSpace(req.ClientID)
+	if clientID != "" {
+		client, err := h.store.GetClient(clientID)
+		if err != nil || client.TokenEndpointAuthMethod == "none" {
+			writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "client_id must be a registered confidential client", "admin_resource_save")
+			return
+		}
+	}
+	resource, err := h.store.SaveResource(ProtectedResource{
+		URI:      uri,
+		Name:     strings.TrimSpace(req.Name),
+		Scopes:   req.Scopes,
+		ClientID: clientID,
+	})
+	if err != nil {
+		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to save resource", "admin_resource_save")
+		return
+	}
+	ctx.JSON(http.StatusOK, resource)
+}
+
+func (h *AdminResourceHandler) HandleDelete(ctx HTTPContext) {
+	uri := strings.TrimSpace(ctx.Query("uri"))
+	if uri == "" {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "uri is required", "admin_resource_delete")
+		return
+	}
+	if err := h.store.DeleteResource(uri); err != nil {
+		if err == ErrResourceNotFound {
+			writeOAuthError(ctx, http.StatusNotFound, "invalid_request", err.Error(), "admin_resource_delete")
+			return
+		}
+		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to delete resource", "admin_resource_delete")
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,156 @@
+package oidc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAdminDetailTypeRegistry(t *testing.T) {
+	store := NewInMemoryStore()
+	handler := NewAdminDetailTypeHandler(store)
+
+	invalid := &fakeContext{bindBody: []byte(`{"type":"answer posting"}`)}
+	handler.HandleSave(invalid)
+	if invalid.statusCode != 400 {
+		t.Fatalf("expected whitespace in type to be rejected, got %d", invalid.statusCode)
+	}
+
+	saved := &fakeContext{bindBody: []byte(`{"type":"answer_posting","name":"Post answers","actions":["create","edit"]}`)}
+	handler.HandleSave(saved)
+	if saved.statusCode != 200 {
+		t.Fatalf("expected 200, got %d %s", saved.statusCode, mustJSON(saved.jsonBody))
+	}
+	if types := store.ListAuthorizationDetailTypes(); len(types) != 1 || len(types[0].Actions) != 2 {
+		t.Fatalf("unexpected registry: %+v", types)
+	}
+
+	deleted := &fakeContext{query: map[string]string{"type": "answer_posting"}}
+	handler.HandleDelete(deleted)
+	if deleted.statusCode != 204 {
+		t.Fatalf("expected 204, got %d", deleted.statusCode)
+	}
+	missing := &fakeContext{query: map[string]string{"type": "answer_posting"}}
+	handler.HandleDelete(missing)
+	if missing.statusCode != 404 {
+		t.Fatalf("expected 404, got %d", missing.statusCode)
+	}
+}
+
+func TestAuthorizationDetailsFlow(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:                      "client_1",
+		Name:                    "client-1",
+		RedirectURIs:            []string{"https://client.example.com/callback"},
+		Scopes:                  []string{"openid", "profile"},
+		GrantTypes:              []string{"authorization_code"},
+		TokenEndpointAuthMethod: "client_secret_post",
+		AccessTokenFormat:       "opaque",
+		Status:                  "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	if _, err = store.SaveAuthorizationDetailType(AuthorizationDetailType{
+		Type:    "answer_posting",
+		Name:    "Post answers",
+		Actions: []string{"create"},
+	}); err != nil {
+		t.Fatalf("save type: %v", err)
+	}
+	ts := newTestTokenService(t, DefaultConfig())
+	authorize := NewAuthorizeHandler(store, DefaultConfig(), ts, func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+
+	for name, tc := range map[string]string{
+		"malformed":      `{"type":"answer_posting"}`,
+		"unregistered":   `[{"type":"payment"}]`,
+		"action":         `[{"type":"answer_posting","actions":["delete"]}]`,
+		"bad location":   `[{"type":"answer_posting","locations":["not a uri"]}]`,
+		"missing type":   `[{"actions":["create"]}]`,
+		"non-string act": `[{"type":"answer_posting","actions":[1]}]`,
+	} {
+		ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"authorization_details": tc, "nonce": "nonce-" + name})}
+		authorize.Handle(ctx)
+		if query := mustRedirectQuery(t, ctx); query.Get("error") != "invalid_authorization_details" {
+			t.Fatalf("%s: expected invalid_authorization_details, got %s", name, ctx.redirect)
+		}
+	}
+
+	granted := `[{"type":"answer_posting","actions":["create"],"tags":["go"]},{"type":"answer_posting","actions":["create"],"tags":["rust"]}]`
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"authorization_details": granted})}
+	authorize.Handle(ctx)
+	if !strings.Contains(ctx.htmlBody, "Post answers (actions: create; tags: go)") {
+		t.Fatalf("consent screen must show authorization details even without prompt=consent, got %q", ctx.htmlBody)
+	}
+	start := strings.Index(ctx.htmlBody, `name="txn" value="`) + len(`name="txn" value="`)
+	txnID := ctx.htmlBody[start : start+strings.Index(ctx.htmlBody[start:], `"`)]
+	approved := &fakeContext{form: map[string]string{"txn": txnID, "decision": "approve"}}
+	authorize.HandleConsent(approved)
+	code := mustRedirectQuery(t, approved).Get("code")
+	if code == "" {
+		t.Fatalf("expected code, got %s", approved.redirect)
+	}
+	consent, err := store.GetConsent("client_1", "u_1")
+	if err != nil || len(consent.AuthorizationDetails) != 2 {
+		t.Fatalf("consent must record authorization details: %+v err=%v", consent, err)
+	}
+
+	again := &fakeContext{query: authorizeTestQuery(map[string]string{
+		"authorization_details": `[{"type":"answer_posting","actions":["create"],"tags":["go"]}]`,
+		"nonce":                 "nonce-again",
+	})}
+	authorize.Handle(again)
+	secondCode := mustRedirectQuery(t, again).Get("code")
+	if secondCode == "" {
+		t.Fatalf("already consented details should not prompt again, got %s", again.redirect)
+	}
+
+	token := NewTokenHandler(store, ts)
+	exchange := func(code, details string) *fakeContext {
+		ctx := &fakeContext{form: map[string]string{
+			"grant_type":            "authorization_code",
+			"client_id":             "client_1",
+			"client_secret":         "secret_1",
+			"code":                  code,
+			"redirect_uri":          "https://client.example.com/callback",
+			"code_verifier":         "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk",
+			"authorization_details": details,
+		}}
+		token.Handle(ctx)
+		return ctx
+	}
+	if widened := exchange(secondCode, `[{"type":"answer_posting","actions":["create"],"tags":["rust"]}]`); mustOAuthError(widened.jsonBody).Error != "invalid_authorization_details" {
+		t.Fatalf("expected ungranted details to be rejected, got %s", mustJSON(widened.jsonBody))
+	}
+	exchanged := exchange(code, `[{"type":"answer_posting","actions":["create"],"tags":["rust"]}]`)
+	response, ok := exchanged.jsonBody.(TokenResponse)
+	if !ok {
+		t.Fatalf("expected token response, got %s", mustJSON(exchanged.jsonBody))
+	}
+	if len(response.AuthorizationDetails) != 1 || response.AuthorizationDetails[0]["tags"].([]any)[0] != "rust" {
+		t.Fatalf("token response must carry the narrowed details: %+v", response.AuthorizationDetails)
+	}
+
+	introspect := &fakeContext{form: map[string]string{"token": response.AccessToken, "client_id": "client_1", "client_secret": "secret_1"}}
+	NewIntrospectHandler(store, ts).Handle(introspect)
+	body := introspect.jsonBody.(map[string]any)
+	details, _ := body["authorization_details"].([]AuthorizationDetail)
+	if body["active"] != true || len(details) != 1 || details[0]["type"] != "answer_posting" {
+		t.Fatalf("introspection must return authorization details: %v", body)
+	}
+
+	jwtToken, _, err := ts.IssueAccessToken(AccessTokenClaims{
+		Audience:             "client_1",
+		Subject:              "u_1",
+		AuthorizationDetails: response.AuthorizationDetails,
+	})
+	if err != nil {
+		t.Fatalf("issue access token: %v", err)
+	}
+	claims, err := ts.ParseAndValidateAccessToken(jwtToken)
+	if embedded, _ := claims["authorization_details"].([]any); err != nil || len(embedded) != 1 {
+		t.Fatalf("jwt access token must embed authorization details: %v err=%v", claims, err)
+	}
+}
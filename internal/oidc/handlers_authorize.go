@@ -5,141 +5,606 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	authorizeTransactionTTL = 15 * time.Minute
+	nonceReplayWindow       = 24 * time.Hour
+)
+
 type UserResolver func(ctx HTTPContext) (UserProfile, error)
 
+type SessionTerminator func(ctx HTTPContext) error
+
 type AuthorizeHandler struct {
 	store            Store
 	config           Config
+	tokenService     *TokenService
 	nowFn            func() time.Time
 	resolveLoginUser UserResolver
+	endSession       SessionTerminator
 }
 
-func NewAuthorizeHandler(store Store, config Config, resolve UserResolver) *AuthorizeHandler {
+func NewAuthorizeHandler(store Store, config Config, tokenService *TokenService, resolve UserResolver) *AuthorizeHandler {
 	return &AuthorizeHandler{
 		store:            store,
 		config:           config.normalize(),
+		tokenService:     tokenService,
 		nowFn:            func() time.Time { return time.Now().UTC() },
 		resolveLoginUser: resolve,
 	}
 }
 
+func (h *AuthorizeHandler) SetSessionTerminator(terminate SessionTerminator) {
+	h.endSession = terminate
+}
+
 func (h *AuthorizeHandler) Handle(ctx HTTPContext) {
-	responseType := ctx.Query("response_type")
-	clientID := strings.TrimSpace(ctx.Query("client_id"))
-	redirectURI := strings.TrimSpace(ctx.Query("redirect_uri"))
-	scope := splitScope(ctx.Query("scope"))
-	state := ctx.Query("state")
-	nonce := ctx.Query("nonce")
-	codeChallenge := strings.TrimSpace(ctx.Query("code_challenge"))
-	codeChallengeMethod := strings.TrimSpace(ctx.Query("code_challenge_method"))
+	if txnID := strings.TrimSpace(ctx.Query("txn")); txnID != "" {
+		h.resume(ctx, txnID)
+		return
+	}
+	req, err := parseAuthorizeRequest(ctx)
+	if err != nil {
+		if client, trusted := h.trustedClient(ctx, req); trusted {
+			req, _ = resolveResponseMode(req, client)
+			errCode := "invalid_request"
+			if errors.Is(err, ErrInvalidAuthorizationDetails) {
+				errCode = "invalid_authorization_details"
+			}
+			h.redirectError(ctx, "", req, errCode, err.Error())
+		}
+		return
+	}
+	h.authorize(ctx, "", AuthorizeTransaction{Request: req})
+}
 
-	if responseType != "code" {
-		writeOAuthError(ctx, http.StatusBadRequest, "unsupported_response_type", "response_type must be code", "authorize")
+func (h *AuthorizeHandler) HandleConsent(ctx HTTPContext) {
+	txnID := strings.TrimSpace(ctx.PostForm("txn"))
+	if txnID == "" {
+		writeAuthorizeErrorPage(ctx, http.StatusBadRequest, "invalid_request", "txn is required")
+		return
+	}
+	txn, ok := h.loadTransaction(ctx, txnID)
+	if !ok {
 		return
 	}
-	if clientID == "" || redirectURI == "" || state == "" {
-		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "client_id, redirect_uri, state are required", "authorize")
+	user, err := h.resolveLoginUser(ctx)
+	if err != nil || txn.UserID == "" || !constantTimeEquals(user.ID, txn.UserID) {
+		writeAuthorizeErrorPage(ctx, http.StatusBadRequest, "invalid_request", "consent does not match the logged in user")
 		return
 	}
-	if codeChallengeMethod != "S256" {
-		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", ErrPKCEMethodNotSupported.Error(), "authorize")
+	if ctx.PostForm("decision") != "approve" {
+		h.redirectError(ctx, txnID, txn.Request, "access_denied", "user denied the authorization request")
 		return
 	}
-	if codeChallenge == "" {
-		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "code_challenge is required", "authorize")
+	txn.ConsentGranted = true
+	h.authorize(ctx, txnID, txn)
+}
+
+func parseAuthorizeRequest(ctx HTTPContext) (AuthorizeRequest, error) {
+	req := AuthorizeRequest{
+		ResponseType:        ctx.Query("response_type"),
+		ClientID:            strings.TrimSpace(ctx.Query("client_id")),
+		RedirectURI:         strings.TrimSpace(ctx.Query("redirect_uri")),
+		Scope:               splitScope(ctx.Query("scope")),
+		State:               ctx.Query("state"),
+		Nonce:               ctx.Query("nonce"),
+		CodeChallenge:       strings.TrimSpace(ctx.Query("code_challenge")),
+		CodeChallengeMethod: strings.TrimSpace(ctx.Query("code_challenge_method")),
+		Prompt:              normalizeScopes(strings.Fields(ctx.Query("prompt"))),
+		LoginHint:           strings.TrimSpace(ctx.Query("login_hint")),
+		IDTokenHint:         strings.TrimSpace(ctx.Query("id_token_hint")),
+		ACRValues:           normalizeScopes(strings.Fields(ctx.Query("acr_values"))),
+		ResponseMode:        strings.TrimSpace(ctx.Query("response_mode")),
+		Resources:           normalizeScopes(ctx.QueryArray("resource")),
+	}
+	if rawMaxAge := strings.TrimSpace(ctx.Query("max_age")); rawMaxAge != "" {
+		maxAge, err := strconv.ParseInt(rawMaxAge, 10, 64)
+		if err != nil || maxAge < 0 {
+			return req, errors.New("max_age must be a non-negative integer")
+		}
+		req.MaxAge = &maxAge
+	}
+	details, err := parseAuthorizationDetails(ctx.Query("authorization_details"))
+	if err != nil {
+		return req, err
+	}
+	req.AuthorizationDetails = details
+	return req, nil
+}
+
+func (h *AuthorizeHandler) resume(ctx HTTPContext, txnID string) {
+	txn, ok := h.loadTransaction(ctx, txnID)
+	if !ok {
 		return
 	}
+	h.authorize(ctx, txnID, txn)
+}
 
-	client, err := h.store.GetClient(clientID)
+func (h *AuthorizeHandler) loadTransaction(ctx HTTPContext, txnID string) (AuthorizeTransaction, bool) {
+	txn, err := h.store.GetAuthorizeTransaction(txnID, h.nowFn())
+	if err != nil {
+		if errors.Is(err, ErrAuthorizeTxnNotFound) || errors.Is(err, ErrAuthorizeTxnExpired) {
+			writeAuthorizeErrorPage(ctx, http.StatusBadRequest, "invalid_request", "authorization request is invalid or expired")
+			return AuthorizeTransaction{}, false
+		}
+		writeAuthorizeErrorPage(ctx, http.StatusInternalServerError, "server_error", "failed to load authorization request")
+		return AuthorizeTransaction{}, false
+	}
+	return txn, true
+}
+
+func (h *AuthorizeHandler) trustedClient(ctx HTTPContext, req AuthorizeRequest) (OIDCClient, bool) {
+	if req.ClientID == "" || req.RedirectURI == "" {
+		writeAuthorizeErrorPage(ctx, http.StatusBadRequest, "invalid_request", "client_id and redirect_uri are required")
+		return OIDCClient{}, false
+	}
+	client, err := h.store.GetClient(req.ClientID)
 	if err != nil || !IsClientActive(client) {
-		writeOAuthError(ctx, http.StatusUnauthorized, "unauthorized_client", "client is invalid", "authorize")
+		writeAuthorizeErrorPage(ctx, http.StatusBadRequest, "unauthorized_client", "client is invalid")
+		return OIDCClient{}, false
+	}
+	if err = ValidateRedirectURI(client, req.RedirectURI); err != nil {
+		writeAuthorizeErrorPage(ctx, http.StatusBadRequest, "invalid_request", ErrInvalidRedirectURI.Error())
+		return OIDCClient{}, false
+	}
+	return client, true
+}
+
+func (h *AuthorizeHandler) authorize(ctx HTTPContext, txnID string, txn AuthorizeTransaction) {
+	client, trusted := h.trustedClient(ctx, txn.Request)
+	if !trusted {
+		return
+	}
+	req, err := resolveResponseMode(txn.Request, client)
+	txn.Request = req
+	if err != nil {
+		h.redirectError(ctx, txnID, req, "invalid_request", err.Error())
+		return
+	}
+	if !containsValue(supportedResponseTypes, req.ResponseType) {
+		h.redirectError(ctx, txnID, req, "unsupported_response_type", "response_type must be code")
+		return
+	}
+	if req.State == "" {
+		h.redirectError(ctx, txnID, req, "invalid_request", "state is required")
+		return
+	}
+	if !containsValue(supportedCodeChallengeMethods, req.CodeChallengeMethod) {
+		h.redirectError(ctx, txnID, req, "invalid_request", ErrPKCEMethodNotSupported.Error())
+		return
+	}
+	if req.CodeChallenge == "" {
+		h.redirectError(ctx, txnID, req, "invalid_request", "code_challenge is required")
 		return
 	}
 	if !ClientAllowsGrantType(client, "authorization_code") {
-		writeOAuthError(ctx, http.StatusBadRequest, "unauthorized_client", ErrUnsupportedGrantType.Error(), "authorize")
+		h.redirectError(ctx, txnID, req, "unauthorized_client", ErrUnsupportedGrantType.Error())
+		return
+	}
+	if err = ValidateScopes(client, req.Scope); err != nil {
+		h.redirectError(ctx, txnID, req, "invalid_scope", ErrInvalidRequestedScope.Error())
+		return
+	}
+	if len(req.Resources) > 0 {
+		resources, err := resolveResources(h.store, req.Resources)
+		if err != nil {
+			h.redirectError(ctx, txnID, req, "invalid_target", err.Error())
+			return
+		}
+		if len(resourceScope(req.Scope, resources)) == 0 {
+			h.redirectError(ctx, txnID, req, "invalid_scope", "no requested scope is accepted by the resource")
+			return
+		}
+	}
+	if err = validateAuthorizationDetails(h.store, req.AuthorizationDetails); err != nil {
+		h.redirectError(ctx, txnID, req, "invalid_authorization_details", err.Error())
+		return
+	}
+	if containsValue(req.Prompt, "select_account") {
+		h.redirectError(ctx, txnID, req, "account_selection_required", "account selection is not supported")
 		return
 	}
-	if err = ValidateRedirectURI(client, redirectURI); err != nil {
-		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", ErrInvalidRedirectURI.Error(), "authorize")
+	if err = validatePrompt(req.Prompt); err != nil {
+		h.redirectError(ctx, txnID, req, "invalid_request", err.Error())
 		return
 	}
-	if err = ValidateScopes(client, scope); err != nil {
-		writeOAuthError(ctx, http.StatusBadRequest, "invalid_scope", ErrInvalidRequestedScope.Error(), "authorize")
+	if !containsValue(req.Scope, "openid") {
+		req.Nonce = ""
+		txn.Request = req
+	} else if client.RequireNonce && req.Nonce == "" {
+		h.redirectError(ctx, txnID, req, "invalid_request", "nonce is required")
 		return
 	}
+	if containsValue(req.Scope, offlineAccessScope) && !offlineAccessAllowed(client, req) {
+		req.Scope = withoutScope(req.Scope, offlineAccessScope)
+		txn.Request = req
+	}
+	scope := req.Scope
+	silent := containsValue(req.Prompt, "none")
+
+	hintedSubject := ""
+	if req.IDTokenHint != "" {
+		hintedSubject, err = h.tokenService.ParseIDTokenHint(req.IDTokenHint)
+		if err != nil {
+			h.redirectError(ctx, txnID, req, "invalid_request", "id_token_hint is invalid")
+			return
+		}
+	}
 
 	user, err := h.resolveLoginUser(ctx)
 	if err != nil {
-		writeOAuthError(ctx, http.StatusUnauthorized, "access_denied", "user not logged in", "authorize")
+		if silent {
+			h.redirectError(ctx, txnID, req, "login_required", "user not logged in")
+			return
+		}
+		if txn.LoginRequestedAt.IsZero() {
+			txn.LoginRequestedAt = h.nowFn()
+		}
+		h.redirectToLogin(ctx, txnID, txn)
 		return
 	}
+	user = resolveAuthentication(h.store, user, h.nowFn())
 
-	if client.FirstParty {
-		_ = h.store.SaveConsent(ConsentRecord{
-			ClientID:   client.ID,
-			UserID:     user.ID,
-			Scope:      scope,
-			FirstParty: true,
-		})
-	} else {
-		if existing, consentErr := h.store.GetConsent(client.ID, user.ID); consentErr == nil {
-			if !scopeIsSubset(scope, existing.Scope) {
-				_ = h.store.SaveConsent(ConsentRecord{
-					ClientID:   client.ID,
-					UserID:     user.ID,
-					Scope:      mergeScopes(existing.Scope, scope),
-					FirstParty: existing.FirstParty,
-				})
+	reauthenticated := !txn.LoginRequestedAt.IsZero() && !user.AuthTime.Before(txn.LoginRequestedAt.Truncate(time.Second))
+	needsLogin := !reauthenticated && (containsValue(req.Prompt, "login") || h.authTooOld(user, req.MaxAge))
+	if !userMatchesHint(user, req.LoginHint, hintedSubject) {
+		needsLogin = true
+	}
+	if needsLogin {
+		if silent || !txn.LoginRequestedAt.IsZero() {
+			h.redirectError(ctx, txnID, req, "login_required", "user must re-authenticate")
+			return
+		}
+		if h.endSession != nil {
+			if err = h.endSession(ctx); err != nil {
+				h.redirectError(ctx, txnID, req, "login_required", "user must re-authenticate")
+				return
 			}
-		} else {
-			_ = h.store.SaveConsent(ConsentRecord{
-				ClientID:   client.ID,
-				UserID:     user.ID,
-				Scope:      scope,
-				FirstParty: false,
-			})
 		}
+		txn.LoginRequestedAt = h.nowFn()
+		h.redirectToLogin(ctx, txnID, txn)
+		return
 	}
 
+	details := req.AuthorizationDetails
+	if silent && !h.hasConsent(client, user, scope, details) {
+		h.redirectError(ctx, txnID, req, "consent_required", "user consent is required")
+		return
+	}
+	needsConsent := containsValue(req.Prompt, "consent") || !h.hasDetailsConsent(client, user, details)
+	if needsConsent && !txn.ConsentGranted {
+		txn.UserID = user.ID
+		h.renderConsent(ctx, txnID, txn, client)
+		return
+	}
+	recordConsent(h.store, client, user.ID, scope, details)
+
+	now := h.nowFn()
+	if req.Nonce != "" {
+		err = h.store.UseNonce(NonceRecord{
+			ClientID:  client.ID,
+			NonceHash: sha256Hex(req.Nonce),
+			ExpiresAt: now.Add(nonceReplayWindow),
+			CreatedAt: now,
+		}, now)
+		if errors.Is(err, ErrNonceReplay) {
+			h.redirectError(ctx, txnID, req, "invalid_request", ErrNonceReplay.Error())
+			return
+		}
+		if err != nil {
+			h.redirectError(ctx, txnID, req, "server_error", "failed to record nonce")
+			return
+		}
+	}
 	rawCode, err := randomURLSafe(32)
 	if err != nil {
-		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to create authorization code", "authorize")
+		h.redirectError(ctx, txnID, req, "server_error", "failed to create authorization code")
 		return
 	}
-	now := h.nowFn()
 	record := AuthCodeRecord{
-		CodeHash:      sha256Hex(rawCode),
-		ClientID:      client.ID,
-		UserID:        user.ID,
-		RedirectURI:   redirectURI,
-		Scope:         scope,
-		CodeChallenge: codeChallenge,
-		CodeMethod:    codeChallengeMethod,
-		Nonce:         nonce,
-		ExpiresAt:     now.Add(h.config.AuthorizationCodeTTL),
-		CreatedAt:     now,
-		OriginalState: state,
+		CodeHash:             sha256Hex(rawCode),
+		ClientID:             client.ID,
+		UserID:               user.ID,
+		RedirectURI:          req.RedirectURI,
+		Scope:                scope,
+		CodeChallenge:        req.CodeChallenge,
+		CodeMethod:           req.CodeChallengeMethod,
+		Nonce:                req.Nonce,
+		ExpiresAt:            now.Add(clientLifetime(time.Duration(client.AuthorizationCodeTTLSeconds)*time.Second, h.config.AuthorizationCodeTTL, h.config.MaxClientCodeTTL)),
+		CreatedAt:            now,
+		OriginalState:        req.State,
+		Issuer:               h.config.issuerURL(),
+		AuthTime:             user.AuthTime,
+		ACR:                  selectACR(req.ACRValues, user.AuthMethods),
+		AMR:                  user.AuthMethods,
+		Roles:                user.Roles,
+		Groups:               user.Groups,
+		Resources:            req.Resources,
+		AuthorizationDetails: details,
 	}
 	if err = h.store.SaveAuthCode(record); err != nil {
-		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to persist authorization code", "authorize")
+		h.redirectError(ctx, txnID, req, "server_error", "failed to persist authorization code")
 		return
 	}
-	callback, err := appendRedirectParams(redirectURI, map[string]string{
+	if txnID != "" {
+		_ = h.store.DeleteAuthorizeTransaction(txnID)
+	}
+	h.respond(ctx, req, map[string]string{
 		"code":  rawCode,
-		"state": state,
+		"state": req.State,
+	})
+}
+
+func resolveAuthentication(store Store, user UserProfile, now time.Time) UserProfile {
+	if len(user.AuthMethods) == 0 {
+		user.AuthMethods = []string{"pwd"}
+	}
+	if !user.AuthTime.IsZero() {
+		return user
+	}
+	if user.SessionID == "" {
+		user.AuthTime = now
+		return user
+	}
+	sessionHash := sha256Hex(user.SessionID)
+	if existing, err := store.GetLoginSession(sessionHash); err == nil && existing.UserID == user.ID {
+		user.AuthTime = existing.AuthTime
+		if len(existing.AuthMethods) > 0 {
+			user.AuthMethods = existing.AuthMethods
+		}
+		return user
+	}
+	_ = store.SaveLoginSession(LoginSessionRecord{
+		SessionHash: sessionHash,
+		UserID:      user.ID,
+		AuthTime:    now,
+		AuthMethods: user.AuthMethods,
 	})
+	user.AuthTime = now
+	return user
+}
+
+func (h *AuthorizeHandler) authTooOld(user UserProfile, maxAge *int64) bool {
+	if maxAge == nil {
+		return false
+	}
+	return h.nowFn().Sub(user.AuthTime) > time.Duration(*maxAge)*time.Second
+}
+
+func (h *AuthorizeHandler) hasConsent(client OIDCClient, user UserProfile, scope []string, details []AuthorizationDetail) bool {
+	if client.FirstParty {
+		return true
+	}
+	existing, err := h.store.GetConsent(client.ID, user.ID)
+	if err != nil || existing.RevokedAt != nil {
+		return false
+	}
+	return scopeIsSubset(scope, existing.Scope) && authorizationDetailsSubset(details, existing.AuthorizationDetails)
+}
+
+func (h *AuthorizeHandler) hasDetailsConsent(client OIDCClient, user UserProfile, details []AuthorizationDetail) bool {
+	if client.FirstParty || len(details) == 0 {
+		return true
+	}
+	existing, err := h.store.GetConsent(client.ID, user.ID)
+	if err != nil || existing.RevokedAt != nil {
+		return false
+	}
+	return authorizationDetailsSubset(details, existing.AuthorizationDetails)
+}
+
+func recordConsent(store Store, client OIDCClient, userID string, scope []string, details []AuthorizationDetail) {
+	offline := containsValue(scope, offlineAccessScope)
+	if client.FirstParty {
+		_ = store.SaveConsent(ConsentRecord{
+			ClientID:             client.ID,
+			UserID:               userID,
+			Scope:                scope,
+			FirstParty:           true,
+			OfflineAccess:        offline,
+			AuthorizationDetails: details,
+		})
+		return
+	}
+	existing, err := store.GetConsent(client.ID, userID)
+	if err != nil {
+		_ = store.SaveConsent(ConsentRecord{
+			ClientID:             client.ID,
+			UserID:               userID,
+			Scope:                scope,
+			FirstParty:           false,
+			OfflineAccess:        offline,
+			AuthorizationDetails: details,
+		})
+		return
+	}
+	if !scopeIsSubset(scope, existing.Scope) || !authorizationDetailsSubset(details, existing.AuthorizationDetails) {
+		_ = store.SaveConsent(ConsentRecord{
+			ClientID:             client.ID,
+			UserID:               userID,
+			Scope:                mergeScopes(existing.Scope, scope),
+			GrantedAt:            existing.GrantedAt,
+			FirstParty:           existing.FirstParty,
+			OfflineAccess:        existing.OfflineAccess || offline,
+			AuthorizationDetails: mergeAuthorizationDetails(existing.AuthorizationDetails, details),
+		})
+	}
+}
+
+func offlineAccessAllowed(client OIDCClient, req AuthorizeRequest) bool {
+	return ClientAllowsGrantType(client, "refresh_token") && containsValue(req.Prompt, "consent")
+}
+
+func withoutScope(scope []string, value string) []string {
+	out := make([]string, 0, len(scope))
+	for _, candidate := range scope {
+		if candidate != value {
+			out = append(out, candidate)
+		}
+	}
+	return out
+}
+
+func (h *AuthorizeHandler) saveTransaction(txnID string, txn AuthorizeTransaction) (string, error) {
+	if txnID == "" {
+		rawID, err := randomURLSafe(24)
+		if err != nil {
+			return "", err
+		}
+		txnID = rawID
+	}
+	if txn.CreatedAt.IsZero() {
+		now := h.nowFn()
+		txn.CreatedAt = now
+		txn.ExpiresAt = now.Add(authorizeTransactionTTL)
+	}
+	txn.IDHash = sha256Hex(txnID)
+	if err := h.store.SaveAuthorizeTransaction(txn); err != nil {
+		return "", err
+	}
+	return txnID, nil
+}
+
+func (h *AuthorizeHandler) redirectToLogin(ctx HTTPContext, txnID string, txn AuthorizeTransaction) {
+	txnID, err := h.saveTransaction(txnID, txn)
+	if err != nil {
+		h.redirectError(ctx, txnID, txn.Request, "server_error", "failed to persist authorization request")
+		return
+	}
+	returnTo := h.config.endpointURL("/authorize?txn=" + url.QueryEscape(txnID))
+	loginURL, err := appendQueryParams(h.config.LoginURL, map[string]string{"redirect": returnTo})
+	if err != nil {
+		h.redirectError(ctx, txnID, txn.Request, "server_error", "failed to render login redirect")
+		return
+	}
+	ctx.Redirect(http.StatusFound, loginURL)
+}
+
+func (h *AuthorizeHandler) renderConsent(ctx HTTPContext, txnID string, txn AuthorizeTransaction, client OIDCClient) {
+	if txnID != "" {
+		_ = h.store.DeleteAuthorizeTransaction(txnID)
+	}
+	txnID, err := h.saveTransaction("", txn)
 	if err != nil {
-		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to render redirect", "authorize")
+		h.redirectError(ctx, txnID, txn.Request, "server_error", "failed to persist authorization request")
 		return
 	}
-	ctx.Redirect(http.StatusFound, callback)
+	page, err := renderConsentPage(consentPageData{
+		ClientName: client.Name,
+		Scopes:     txn.Request.Scope,
+		Offline:    containsValue(txn.Request.Scope, offlineAccessScope),
+		Details:    describeAuthorizationDetails(h.store, txn.Request.AuthorizationDetails),
+		TxnID:      txnID,
+	})
+	if err != nil {
+		h.redirectError(ctx, txnID, txn.Request, "server_error", "failed to render consent page")
+		return
+	}
+	ctx.HTML(http.StatusOK, page)
+}
+
+func (h *AuthorizeHandler) redirectError(ctx HTTPContext, txnID string, req AuthorizeRequest, errCode, description string) {
+	if txnID != "" {
+		_ = h.store.DeleteAuthorizeTransaction(txnID)
+	}
+	params := map[string]string{
+		"error":             errCode,
+		"error_description": description,
+	}
+	if req.State != "" {
+		params["state"] = req.State
+	}
+	h.respond(ctx, req, params)
+}
+
+func (h *AuthorizeHandler) respond(ctx HTTPContext, req AuthorizeRequest, params map[string]string) {
+	mode := req.ResponseMode
+	if isJWTResponseMode(mode) {
+		response, err := h.tokenService.IssueAuthorizationResponse(req.ClientID, params)
+		if err != nil {
+			writeAuthorizeErrorPage(ctx, http.StatusInternalServerError, "server_error", "failed to sign authorization response")
+			return
+		}
+		params = map[string]string{"response": response}
+		mode = strings.TrimSuffix(mode, ".jwt")
+	} else {
+		params["iss"] = h.config.issuerURL()
+	}
+	switch mode {
+	case "form_post":
+		if _, err := parseRedirectTarget(req.RedirectURI); err != nil {
+			writeAuthorizeErrorPage(ctx, http.StatusBadRequest, "invalid_request", ErrInvalidRedirectURI.Error())
+			return
+		}
+		page, err := renderFormPostPage(formPostPageData{Action: req.RedirectURI, Params: params})
+		if err != nil {
+			writeAuthorizeErrorPage(ctx, http.StatusInternalServerError, "server_error", "failed to render form post response")
+			return
+		}
+		ctx.HTML(http.StatusOK, page)
+	case "fragment":
+		callback, err := appendRedirectFragment(req.RedirectURI, params)
+		if err != nil {
+			writeAuthorizeErrorPage(ctx, http.StatusBadRequest, "invalid_request", ErrInvalidRedirectURI.Error())
+			return
+		}
+		ctx.Redirect(http.StatusFound, callback)
+	default:
+		callback, err := appendRedirectParams(req.RedirectURI, params)
+		if err != nil {
+			writeAuthorizeErrorPage(ctx, http.StatusBadRequest, "invalid_request", ErrInvalidRedirectURI.Error())
+			return
+		}
+		ctx.Redirect(http.StatusFound, callback)
+	}
+}
+
+func writeAuthorizeErrorPage(ctx HTTPContext, status int, errCode, description string) {
+	page, err := renderErrorPage(errorPageData{Error: errCode, Description: description})
+	if err != nil {
+		writeOAuthError(ctx, status, errCode, description, "authorize")
+		return
+	}
+	ctx.HTML(status, page)
+}
+
+func validatePrompt(prompt []string) error {
+	for _, value := range prompt {
+		if !containsValue(supportedPromptValues, value) {
+			return fmt.Errorf("prompt value %q is not supported", value)
+		}
+	}
+	if containsValue(prompt, "none") && len(prompt) > 1 {
+		return errors.New("prompt=none cannot be combined with other values")
+	}
+	return nil
+}
+
+func userMatchesHint(user UserProfile, loginHint, hintedSubject string) bool {
+	if hintedSubject != "" && hintedSubject != user.ID {
+		return false
+	}
+	if loginHint == "" {
+		return true
+	}
+	return loginHint == user.ID ||
+		(user.Username != "" && strings.EqualFold(loginHint, user.Username)) ||
+		(user.Email != "" && strings.EqualFold(loginHint, user.Email))
 }
 
 func appendRedirectParams(base string, values map[string]string) (string, error) {
+	if _, err := parseRedirectTarget(base); err != nil {
+		return "", err
+	}
+	return appendQueryParams(base, values)
+}
+
+func appendQueryParams(base string, values map[string]string) (string, error) {
 	u, err := url.Parse(base)
 	if err != nil {
 		return "", err
@@ -149,9 +614,6 @@ func appendRedirectParams(base string, values map[string]string) (string, error)
 		q.Set(key, value)
 	}
 	u.RawQuery = q.Encode()
-	if !strings.HasPrefix(u.Scheme, "http") {
-		return "", errors.New("invalid redirect uri")
-	}
 	return u.String(), nil
 }
 
@@ -0,0 +1,652 @@
+package oidc
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newAuthorizeTestStore(t *testing.T) *InMemoryStore {
+	t.Helper()
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:           "client_1",
+		Name:         "client-1",
+		RedirectURIs: []string{"https://client.example.com/callback"},
+		Scopes:       []string{"openid", "profile"},
+		GrantTypes:   []string{"authorization_code", "refresh_token"},
+		Status:       "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	return store
+}
+
+func authorizeTestQuery(extra map[string]string) map[string]string {
+	query := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client_1",
+		"redirect_uri":          "https://client.example.com/callback",
+		"scope":                 "openid profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		"code_challenge_method": "S256",
+	}
+	for key, value := range extra {
+		query[key] = value
+	}
+	return query
+}
+
+func mustRedirectQuery(t *testing.T, ctx *fakeContext) url.Values {
+	t.Helper()
+	if ctx.statusCode != 302 {
+		t.Fatalf("expected redirect, got %d body=%s html=%s", ctx.statusCode, mustJSON(ctx.jsonBody), ctx.htmlBody)
+	}
+	u, err := url.Parse(ctx.redirect)
+	if err != nil {
+		t.Fatalf("parse redirect: %v", err)
+	}
+	return u.Query()
+}
+
+func TestAuthorizePromptNoneRequiresLogin(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{}, errors.New("no login user")
+	})
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"prompt": "none"})}
+	handler.Handle(ctx)
+
+	query := mustRedirectQuery(t, ctx)
+	if !strings.HasPrefix(ctx.redirect, "https://client.example.com/callback") {
+		t.Fatalf("expected redirect to client, got %s", ctx.redirect)
+	}
+	if query.Get("error") != "login_required" || query.Get("state") != "state-1" {
+		t.Fatalf("unexpected error redirect: %s", ctx.redirect)
+	}
+}
+
+func TestAuthorizePromptNoneRequiresConsent(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"prompt": "none"})}
+	handler.Handle(ctx)
+
+	if query := mustRedirectQuery(t, ctx); query.Get("error") != "consent_required" {
+		t.Fatalf("expected consent_required, got %s", ctx.redirect)
+	}
+
+	if err := store.SaveConsent(ConsentRecord{ClientID: "client_1", UserID: "u_1", Scope: []string{"openid", "profile"}}); err != nil {
+		t.Fatalf("save consent: %v", err)
+	}
+	ctx = &fakeContext{query: authorizeTestQuery(map[string]string{"prompt": "none"})}
+	handler.Handle(ctx)
+	if query := mustRedirectQuery(t, ctx); query.Get("code") == "" {
+		t.Fatalf("expected silent authorization to succeed, got %s", ctx.redirect)
+	}
+}
+
+func TestAuthorizeMaxAgeForcesLogin(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	authTime := time.Now().UTC().Add(-time.Hour)
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1", AuthTime: authTime}, nil
+	})
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"max_age": "60"})}
+	handler.Handle(ctx)
+
+	mustRedirectQuery(t, ctx)
+	if !strings.HasPrefix(ctx.redirect, "/users/login") {
+		t.Fatalf("expected login redirect, got %s", ctx.redirect)
+	}
+
+	authTime = time.Now().UTC().Add(time.Second)
+	returnTo, err := url.Parse(mustRedirectQuery(t, ctx).Get("redirect"))
+	if err != nil {
+		t.Fatalf("parse return url: %v", err)
+	}
+	resumed := &fakeContext{query: map[string]string{"txn": returnTo.Query().Get("txn")}}
+	handler.Handle(resumed)
+	if query := mustRedirectQuery(t, resumed); query.Get("code") == "" {
+		t.Fatalf("expected code after re-authentication, got %s", resumed.redirect)
+	}
+}
+
+func TestAuthorizePromptLoginEndsSession(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	if err := store.SaveConsent(ConsentRecord{ClientID: "client_1", UserID: "u_1", Scope: []string{"openid", "profile"}}); err != nil {
+		t.Fatalf("save consent: %v", err)
+	}
+	authTime := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1", AuthTime: authTime}, nil
+	})
+	ended := 0
+	handler.SetSessionTerminator(func(_ HTTPContext) error {
+		ended++
+		return nil
+	})
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"prompt": "login"})}
+	handler.Handle(ctx)
+	if !strings.HasPrefix(ctx.redirect, "/users/login") || ended != 1 {
+		t.Fatalf("expected session end and login redirect, got %s ended=%d", ctx.redirect, ended)
+	}
+
+	returnTo, err := url.Parse(mustRedirectQuery(t, ctx).Get("redirect"))
+	if err != nil {
+		t.Fatalf("parse return url: %v", err)
+	}
+	resumed := &fakeContext{query: map[string]string{"txn": returnTo.Query().Get("txn")}}
+	handler.Handle(resumed)
+	if query := mustRedirectQuery(t, resumed); query.Get("error") != "login_required" {
+		t.Fatalf("expected login_required without a new login, got %s", resumed.redirect)
+	}
+
+	ctx = &fakeContext{query: authorizeTestQuery(map[string]string{"prompt": "login"})}
+	handler.Handle(ctx)
+	returnTo, err = url.Parse(mustRedirectQuery(t, ctx).Get("redirect"))
+	if err != nil {
+		t.Fatalf("parse return url: %v", err)
+	}
+	authTime = time.Now().UTC().Truncate(time.Second)
+	resumed = &fakeContext{query: map[string]string{"txn": returnTo.Query().Get("txn")}}
+	handler.Handle(resumed)
+	if query := mustRedirectQuery(t, resumed); query.Get("code") == "" {
+		t.Fatalf("expected code after a new login, got %s", resumed.redirect)
+	}
+
+	handler.SetSessionTerminator(func(_ HTTPContext) error {
+		return errors.New("logout failed")
+	})
+	ctx = &fakeContext{query: authorizeTestQuery(map[string]string{"prompt": "login"})}
+	handler.Handle(ctx)
+	if query := mustRedirectQuery(t, ctx); query.Get("error") != "login_required" {
+		t.Fatalf("expected login_required when the session cannot be ended, got %s", ctx.redirect)
+	}
+}
+
+func TestAuthorizeConsentUsesFreshTransaction(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	loggedIn := false
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		if !loggedIn {
+			return UserProfile{}, errors.New("no login user")
+		}
+		return UserProfile{ID: "u_1"}, nil
+	})
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"prompt": "consent"})}
+	handler.Handle(ctx)
+	returnTo, err := url.Parse(mustRedirectQuery(t, ctx).Get("redirect"))
+	if err != nil {
+		t.Fatalf("parse return url: %v", err)
+	}
+	loginTxn := returnTo.Query().Get("txn")
+
+	loggedIn = true
+	resumed := &fakeContext{query: map[string]string{"txn": loginTxn}}
+	handler.Handle(resumed)
+	start := strings.Index(resumed.htmlBody, `name="txn" value="`) + len(`name="txn" value="`)
+	consentTxn := resumed.htmlBody[start : start+strings.Index(resumed.htmlBody[start:], `"`)]
+	if consentTxn == "" || consentTxn == loginTxn {
+		t.Fatalf("expected a fresh consent transaction, got %q", consentTxn)
+	}
+
+	forged := &fakeContext{form: map[string]string{"txn": loginTxn, "decision": "approve"}}
+	handler.HandleConsent(forged)
+	if forged.statusCode != 400 {
+		t.Fatalf("expected the login transaction to be rejected, got %d redirect=%s", forged.statusCode, forged.redirect)
+	}
+	approved := &fakeContext{form: map[string]string{"txn": consentTxn, "decision": "approve"}}
+	handler.HandleConsent(approved)
+	if query := mustRedirectQuery(t, approved); query.Get("code") == "" {
+		t.Fatalf("expected code after consent, got %s", approved.redirect)
+	}
+}
+
+func TestAuthorizePromptConsentShowsConsentScreen(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	if err := store.SaveConsent(ConsentRecord{ClientID: "client_1", UserID: "u_1", Scope: []string{"openid", "profile"}}); err != nil {
+		t.Fatalf("save consent: %v", err)
+	}
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"prompt": "consent"})}
+	handler.Handle(ctx)
+
+	if ctx.statusCode != 200 || !strings.Contains(ctx.htmlBody, `name="txn"`) {
+		t.Fatalf("expected consent screen, got %d redirect=%s", ctx.statusCode, ctx.redirect)
+	}
+	start := strings.Index(ctx.htmlBody, `name="txn" value="`) + len(`name="txn" value="`)
+	txnID := ctx.htmlBody[start : start+strings.Index(ctx.htmlBody[start:], `"`)]
+
+	approved := &fakeContext{form: map[string]string{"txn": txnID, "decision": "approve"}}
+	handler.HandleConsent(approved)
+	if query := mustRedirectQuery(t, approved); query.Get("code") == "" || query.Get("state") != "state-1" {
+		t.Fatalf("expected code after consent, got %s", approved.redirect)
+	}
+}
+
+func TestAuthorizeRendersErrorPageForUntrustedRedirect(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"redirect_uri": "https://evil.example.com/callback"})}
+	handler.Handle(ctx)
+
+	if ctx.statusCode != 400 || ctx.redirect != "" {
+		t.Fatalf("expected error page without redirect, got %d redirect=%s", ctx.statusCode, ctx.redirect)
+	}
+	if !strings.Contains(ctx.htmlBody, "invalid_request") {
+		t.Fatalf("unexpected error page: %s", ctx.htmlBody)
+	}
+}
+
+func TestAuthorizeRedirectsErrorsAfterRedirectURITrusted(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"scope": "openid admin"})}
+	handler.Handle(ctx)
+
+	query := mustRedirectQuery(t, ctx)
+	if query.Get("error") != "invalid_scope" || query.Get("error_description") == "" || query.Get("state") != "state-1" {
+		t.Fatalf("unexpected error redirect: %s", ctx.redirect)
+	}
+}
+
+func TestAuthorizeFormPostResponseMode(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"response_mode": "form_post"})}
+	handler.Handle(ctx)
+
+	if ctx.statusCode != 200 || ctx.redirect != "" {
+		t.Fatalf("expected form post page, got %d redirect=%s", ctx.statusCode, ctx.redirect)
+	}
+	if !strings.Contains(ctx.htmlBody, `action="https://client.example.com/callback"`) ||
+		!strings.Contains(ctx.htmlBody, `name="code"`) ||
+		!strings.Contains(ctx.htmlBody, `name="state" value="state-1"`) {
+		t.Fatalf("unexpected form post page: %s", ctx.htmlBody)
+	}
+}
+
+func TestAuthorizeFormPostRequiresHTTPRedirect(t *testing.T) {
+	store := NewInMemoryStore()
+	if _, _, err := store.CreateClient(OIDCClient{
+		ID:                      "native_1",
+		Name:                    "Mobile App",
+		RedirectURIs:            []string{"com.example.app:/callback"},
+		Scopes:                  []string{"openid", "profile"},
+		GrantTypes:              []string{"authorization_code"},
+		TokenEndpointAuthMethod: "none",
+		FirstParty:              true,
+		Status:                  "active",
+	}, ""); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+
+	for _, mode := range []string{"form_post", "form_post.jwt"} {
+		ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"client_id": "native_1", "redirect_uri": "com.example.app:/callback", "response_mode": mode})}
+		handler.Handle(ctx)
+		query := mustRedirectQuery(t, ctx)
+		if ctx.htmlBody != "" || query.Get("error") != "invalid_request" || query.Get("code") != "" {
+			t.Fatalf("%s: expected invalid_request redirect, got %s body=%s", mode, ctx.redirect, ctx.htmlBody)
+		}
+		if strings.Contains(ctx.redirect, "ZgotmplZ") || !strings.HasPrefix(ctx.redirect, "com.example.app:/callback?") {
+			t.Fatalf("%s: unexpected redirect target %s", mode, ctx.redirect)
+		}
+	}
+}
+
+func TestAuthorizeFragmentResponseModeFromClientDefault(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	if _, err := store.UpdateClient(OIDCClient{ID: "client_1", DefaultResponseMode: "fragment"}); err != nil {
+		t.Fatalf("update client: %v", err)
+	}
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+	ctx := &fakeContext{query: authorizeTestQuery(nil)}
+	handler.Handle(ctx)
+
+	mustRedirectQuery(t, ctx)
+	u, err := url.Parse(ctx.redirect)
+	if err != nil {
+		t.Fatalf("parse redirect: %v", err)
+	}
+	fragment, err := url.ParseQuery(u.Fragment)
+	if err != nil {
+		t.Fatalf("parse fragment: %v", err)
+	}
+	if u.RawQuery != "" || fragment.Get("code") == "" || fragment.Get("state") != "state-1" {
+		t.Fatalf("expected code in fragment, got %s", ctx.redirect)
+	}
+}
+
+func TestAuthorizeJWTResponseMode(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	config := DefaultConfig()
+	config.Issuer = "https://answer.example.com"
+	ts := newTestTokenService(t, config)
+	handler := NewAuthorizeHandler(store, config, ts, func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"response_mode": "jwt"})}
+	handler.Handle(ctx)
+
+	query := mustRedirectQuery(t, ctx)
+	if query.Get("code") != "" || query.Get("response") == "" {
+		t.Fatalf("expected signed response parameter only, got %s", ctx.redirect)
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(query.Get("response"), claims, func(token *jwt.Token) (interface{}, error) {
+		return ts.keyService.PublicKey(), nil
+	}, jwt.WithIssuer("https://answer.example.com"), jwt.WithAudience("client_1")); err != nil {
+		t.Fatalf("parse authorization response: %v", err)
+	}
+	if claims["code"] == "" || claims["state"] != "state-1" {
+		t.Fatalf("unexpected authorization response claims: %v", claims)
+	}
+}
+
+func TestAuthorizeResponsesIncludeIssuer(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	config := DefaultConfig()
+	config.Issuer = "https://answer.example.com"
+	handler := NewAuthorizeHandler(store, config, newTestTokenService(t, config), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+
+	ctx := &fakeContext{query: authorizeTestQuery(nil)}
+	handler.Handle(ctx)
+	if query := mustRedirectQuery(t, ctx); query.Get("code") == "" || query.Get("iss") != "https://answer.example.com" {
+		t.Fatalf("expected code with iss, got %s", ctx.redirect)
+	}
+
+	ctx = &fakeContext{query: authorizeTestQuery(map[string]string{"scope": "openid admin"})}
+	handler.Handle(ctx)
+	if query := mustRedirectQuery(t, ctx); query.Get("error") == "" || query.Get("iss") != "https://answer.example.com" {
+		t.Fatalf("expected error with iss, got %s", ctx.redirect)
+	}
+}
+
+func TestAuthorizeOfflineAccessRequiresPromptConsent(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:           "client_1",
+		Name:         "client-1",
+		RedirectURIs: []string{"https://client.example.com/callback"},
+		Scopes:       []string{"openid", "profile", "offline_access"},
+		GrantTypes:   []string{"authorization_code", "refresh_token"},
+		Status:       "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+	codeScope := func(ctx *fakeContext) []string {
+		code := mustRedirectQuery(t, ctx).Get("code")
+		record, err := store.ConsumeAuthCode(code, time.Now().UTC())
+		if err != nil {
+			t.Fatalf("consume code: %v", err)
+		}
+		return record.Scope
+	}
+
+	online := &fakeContext{query: authorizeTestQuery(map[string]string{"scope": "openid offline_access"})}
+	handler.Handle(online)
+	if scope := codeScope(online); containsValue(scope, offlineAccessScope) {
+		t.Fatalf("offline_access without prompt=consent must be ignored, got %v", scope)
+	}
+	if consent, _ := store.GetConsent("client_1", "u_1"); consent.OfflineAccess {
+		t.Fatalf("online grant recorded as offline")
+	}
+
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"scope": "openid offline_access", "prompt": "consent", "nonce": "nonce-2"})}
+	handler.Handle(ctx)
+	if !strings.Contains(ctx.htmlBody, "keep access while you are signed out") {
+		t.Fatalf("expected consent screen to mention offline access, got %s", ctx.htmlBody)
+	}
+	start := strings.Index(ctx.htmlBody, `name="txn" value="`) + len(`name="txn" value="`)
+	txnID := ctx.htmlBody[start : start+strings.Index(ctx.htmlBody[start:], `"`)]
+	approved := &fakeContext{form: map[string]string{"txn": txnID, "decision": "approve"}}
+	handler.HandleConsent(approved)
+	if scope := codeScope(approved); !containsValue(scope, offlineAccessScope) {
+		t.Fatalf("expected offline_access after consent, got %v", scope)
+	}
+	if consent, _ := store.GetConsent("client_1", "u_1"); !consent.OfflineAccess {
+		t.Fatalf("expected consent to record offline access")
+	}
+}
+
+func TestAuthorizeNonceRequirementAndReplay(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:           "client_1",
+		Name:         "client-1",
+		RedirectURIs: []string{"https://client.example.com/callback"},
+		Scopes:       []string{"openid", "profile"},
+		GrantTypes:   []string{"authorization_code"},
+		RequireNonce: true,
+		Status:       "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+
+	missing := &fakeContext{query: authorizeTestQuery(map[string]string{"nonce": ""})}
+	handler.Handle(missing)
+	if query := mustRedirectQuery(t, missing); query.Get("error") != "invalid_request" {
+		t.Fatalf("expected nonce to be required, got %s", missing.redirect)
+	}
+
+	oauthOnly := &fakeContext{query: authorizeTestQuery(map[string]string{"scope": "profile", "nonce": ""})}
+	handler.Handle(oauthOnly)
+	if query := mustRedirectQuery(t, oauthOnly); query.Get("code") == "" {
+		t.Fatalf("pure OAuth request must not require a nonce, got %s", oauthOnly.redirect)
+	}
+
+	first := &fakeContext{query: authorizeTestQuery(nil)}
+	handler.Handle(first)
+	if query := mustRedirectQuery(t, first); query.Get("code") == "" {
+		t.Fatalf("expected code, got %s", first.redirect)
+	}
+	replay := &fakeContext{query: authorizeTestQuery(nil)}
+	handler.Handle(replay)
+	if query := mustRedirectQuery(t, replay); query.Get("error") != "invalid_request" || query.Get("error_description") != ErrNonceReplay.Error() {
+		t.Fatalf("expected nonce replay to be rejected, got %s", replay.redirect)
+	}
+}
+
+func TestAuthorizeNativeRedirectURIs(t *testing.T) {
+	store := NewInMemoryStore()
+	if _, _, err := store.CreateClient(OIDCClient{
+		ID:                      "native_1",
+		Name:                    "Mobile App",
+		RedirectURIs:            []string{"com.example.app:/callback", "http://127.0.0.1/callback", "http://[::1]:8080/callback"},
+		Scopes:                  []string{"openid", "profile"},
+		GrantTypes:              []string{"authorization_code"},
+		TokenEndpointAuthMethod: "none",
+		FirstParty:              true,
+		Status:                  "active",
+	}, ""); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+
+	for i, redirectURI := range []string{
+		"com.example.app:/callback",
+		"http://127.0.0.1:53121/callback",
+		"http://127.0.0.1/callback",
+		"http://[::1]:49152/callback",
+	} {
+		ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"client_id": "native_1", "redirect_uri": redirectURI, "nonce": fmt.Sprintf("nonce-native-%d", i)})}
+		handler.Handle(ctx)
+		if query := mustRedirectQuery(t, ctx); query.Get("code") == "" || !strings.HasPrefix(ctx.redirect, strings.Split(redirectURI, "/callback")[0]) {
+			t.Fatalf("%s: expected code redirect, got %s", redirectURI, ctx.redirect)
+		}
+	}
+
+	for _, redirectURI := range []string{
+		"http://localhost:53121/callback",
+		"http://127.0.0.1:53121/other",
+		"https://127.0.0.1:53121/callback",
+		"http://127.0.0.2:53121/callback",
+		"com.example.app:/callback#frag",
+		"com.evil.app:/callback",
+	} {
+		ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"client_id": "native_1", "redirect_uri": redirectURI})}
+		handler.Handle(ctx)
+		if ctx.statusCode != 400 || ctx.redirect != "" {
+			t.Fatalf("%s: expected rejection without redirect, got %d %s", redirectURI, ctx.statusCode, ctx.redirect)
+		}
+	}
+
+	for _, redirectURI := range []string{"javascript:alert(1)", "data:text/html,hi"} {
+		if ValidateRedirectURI(OIDCClient{RedirectURIs: []string{redirectURI}}, redirectURI) == nil {
+			t.Fatalf("%s: expected script scheme to be rejected even when stored", redirectURI)
+		}
+	}
+}
+
+func TestAuthorizeKeepsStoredLegacyRedirectURIs(t *testing.T) {
+	store := NewInMemoryStore()
+	if _, _, err := store.CreateClient(OIDCClient{
+		ID:                      "legacy_1",
+		Name:                    "Legacy App",
+		RedirectURIs:            []string{"http://localhost:3000/callback", "myapp:/callback", "com.example.app:/callback"},
+		Scopes:                  []string{"openid", "profile"},
+		GrantTypes:              []string{"authorization_code"},
+		TokenEndpointAuthMethod: "client_secret_post",
+		FirstParty:              true,
+		Status:                  "active",
+	}, "secret"); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+
+	for i, redirectURI := range []string{"http://localhost:3000/callback", "myapp:/callback", "com.example.app:/callback"} {
+		ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"client_id": "legacy_1", "redirect_uri": redirectURI, "nonce": fmt.Sprintf("nonce-legacy-%d", i)})}
+		handler.Handle(ctx)
+		if query := mustRedirectQuery(t, ctx); query.Get("code") == "" || !strings.HasPrefix(ctx.redirect, redirectURI) {
+			t.Fatalf("%s: expected code redirect, got %s", redirectURI, ctx.redirect)
+		}
+	}
+
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"client_id": "legacy_1", "redirect_uri": "http://localhost:4000/callback"})}
+	handler.Handle(ctx)
+	if ctx.statusCode != 400 || ctx.redirect != "" {
+		t.Fatalf("expected unregistered localhost port to be rejected, got %d %s", ctx.statusCode, ctx.redirect)
+	}
+}
+
+func TestRedirectURIPatterns(t *testing.T) {
+	client := OIDCClient{
+		RedirectURIs:          []string{"https://app.example.com/callback"},
+		RedirectURIPatterns:   []string{"https://*.preview.example.com/callback"},
+		AllowRedirectPatterns: true,
+	}
+	for _, uri := range []string{
+		"https://pr-123.preview.example.com/callback",
+		"https://PR-7.Preview.Example.com/callback",
+		"https://app.example.com/callback",
+	} {
+		if err := ValidateRedirectURI(client, uri); err != nil {
+			t.Fatalf("%s: expected match, got %v", uri, err)
+		}
+	}
+
+	for _, uri := range []string{
+		"https://evil.com/callback",
+		"https://preview.example.com/callback",
+		"https://a.b.preview.example.com/callback",
+		"https://evilpreview.example.com/callback",
+		"https://pr-1.preview.example.com.evil.com/callback",
+		"https://pr-1.preview.example.com@evil.com/callback",
+		"https://evil.com@pr-1.preview.example.com/callback",
+		"https://evil.com%2f.preview.example.com/callback",
+		"https://evil%2ecom.preview.example.com/callback",
+		"https://pr-1.preview.example.com\\@evil.com/callback",
+		"https://pr-1.preview.example.com./callback",
+		"http://pr-1.preview.example.com/callback",
+		"https://pr-1.preview.example.com:8443/callback",
+		"https://pr-1.preview.example.com/callback/../evil",
+		"https://pr-1.preview.example.com/callback/",
+		"https://pr-1.preview.example.com/Callback",
+		"https://pr-1.preview.example.com/callback?next=https://evil.com",
+		"https://pr-1.preview.example.com/callback#@evil.com",
+		"https://-pr.preview.example.com/callback",
+		"https://pr_1.preview.example.com/callback",
+		"https://*.preview.example.com/callback",
+		"//pr-1.preview.example.com/callback",
+		"https:pr-1.preview.example.com/callback",
+	} {
+		if err := ValidateRedirectURI(client, uri); err == nil {
+			t.Fatalf("%s: expected rejection", uri)
+		}
+	}
+
+	client.AllowRedirectPatterns = false
+	if err := ValidateRedirectURI(client, "https://pr-123.preview.example.com/callback"); err == nil {
+		t.Fatalf("patterns must be ignored without allow_redirect_patterns")
+	}
+}
+
+func TestAuthorizeSelectAccountNotSupported(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"prompt": "select_account"})}
+	handler.Handle(ctx)
+	if query := mustRedirectQuery(t, ctx); query.Get("error") != "account_selection_required" {
+		t.Fatalf("expected account_selection_required, got %s", ctx.redirect)
+	}
+	if containsValue(supportedPromptValues, "select_account") {
+		t.Fatalf("select_account must not be advertised")
+	}
+}
+
+func TestAuthorizeRejectsAccessTokenAsIDTokenHint(t *testing.T) {
+	store := newAuthorizeTestStore(t)
+	ts := newTestTokenService(t, DefaultConfig())
+	handler := NewAuthorizeHandler(store, DefaultConfig(), ts, func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+	accessToken, _, err := ts.IssueAccessToken(AccessTokenClaims{Audience: "client_1", Subject: "u_1"})
+	if err != nil {
+		t.Fatalf("issue access token: %v", err)
+	}
+	ctx := &fakeContext{query: authorizeTestQuery(map[string]string{"id_token_hint": accessToken})}
+	handler.Handle(ctx)
+	if query := mustRedirectQuery(t, ctx); query.Get("error") != "invalid_request" {
+		t.Fatalf("access token must not be accepted as id_token_hint, got %s", ctx.redirect)
+	}
+}
@@ -0,0 +1,305 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	backchannelRequestTTL     = 5 * time.Minute
+	backchannelPollInterval   = 5
+	backchannelSlowDownStep   = 5
+	backchannelBindingMaxLen  = 64
+	backchannelStatusPending  = "pending"
+	backchannelStatusApproved = "approved"
+	backchannelStatusDenied   = "denied"
+)
+
+type UserHintResolver func(hint string) (UserProfile, error)
+
+type BackchannelHandler struct {
+	store            Store
+	tokenService     *TokenService
+	nowFn            func() time.Time
+	lookupUser       UserHintResolver
+	resolveLoginUser UserResolver
+}
+
+func NewBackchannelHandler(store Store, tokenService *TokenService, lookup UserHintResolver, resolve UserResolver) *BackchannelHandler {
+	return &BackchannelHandler{
+		store:            store,
+		tokenService:     tokenService,
+		nowFn:            func() time.Time { return time.Now().UTC() },
+		lookupUser:       lookup,
+		resolveLoginUser: resolve,
+	}
+}
+
+func (h *BackchannelHandler) HandleAuthenticate(ctx HTTPContext) {
+	clientID := strings.TrimSpace(ctx.PostForm("client_id"))
+	clientSecret := strings.TrimSpace(ctx.PostForm("client_secret"))
+	if clientID == "" {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "client_id is required", "backchannel")
+		return
+	}
+	client, err := h.store.ValidateClientSecret(clientID, clientSecret)
+	if err != nil {
+		writeOAuthError(ctx, http.StatusUnauthorized, "invalid_client", "client credentials are invalid", "backchannel")
+		return
+	}
+	if !ClientAllowsGrantType(client, cibaGrantType) || client.TokenEndpointAuthMethod == "none" {
+		writeOAuthError(ctx, http.StatusBadRequest, "unauthorized_client", ErrUnsupportedGrantType.Error(), "backchannel")
+		return
+	}
+	scope := splitScope(ctx.PostForm("scope"))
+	if !containsValue(scope, "openid") || ValidateScopes(client, scope) != nil {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_scope", "scope must include openid and only allowed scopes", "backchannel")
+		return
+	}
+	if !ClientAllowsGrantType(client, "refresh_token") {
+		scope = withoutScope(scope, offlineAccessScope)
+	}
+	user, ok := h.hintedUser(ctx)
+	if !ok {
+		return
+	}
+	bindingMessage := strings.TrimSpace(ctx.PostForm("binding_message"))
+	if !validBindingMessage(bindingMessage) {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_binding_message", "binding_message is too long or contains control characters", "backchannel")
+		return
+	}
+	expiresIn := backchannelRequestTTL
+	if raw := strings.TrimSpace(ctx.PostForm("requested_expiry")); raw != "" {
+		requested, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || requested <= 0 {
+			writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "requested_expiry must be a positive integer", "backchannel")
+			return
+		}
+		if time.Duration(requested)*time.Second < expiresIn {
+			expiresIn = time.Duration(requested) * time.Second
+		}
+	}
+
+	rawID, err := randomURLSafe(32)
+	if err != nil {
+		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to create auth_req_id", "backchannel")
+		return
+	}
+	now := h.nowFn()
+	if err = h.store.SaveBackchannelRequest(BackchannelAuthRequest{
+		IDHash:         sha256Hex(rawID),
+		ClientID:       client.ID,
+		UserID:         user.ID,
+		Scope:          scope,
+		BindingMessage: bindingMessage,
+		Status:         backchannelStatusPending,
+		Interval:       backchannelPollInterval,
+		ExpiresAt:      now.Add(expiresIn),
+		CreatedAt:      now,
+	}); err != nil {
+		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to persist backchannel request", "backchannel")
+		return
+	}
+	ctx.JSON(http.StatusOK, map[string]any{
+		"auth_req_id": rawID,
+		"expires_in":  int64(expiresIn / time.Second),
+		"interval":    backchannelPollInterval,
+	})
+}
+
+func (h *BackchannelHandler) hintedUser(ctx HTTPContext) (UserProfile, bool) {
+	loginHint := strings.TrimSpace(ctx.PostForm("login_hint"))
+	idTokenHint := strings.TrimSpace(ctx.PostForm("id_token_hint"))
+	if ctx.PostForm("login_hint_token") != "" {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "login_hint_token is not supported", "backchannel")
+		return UserProfile{}, false
+	}
+	if (loginHint == "") == (idTokenHint == "") {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "exactly one of login_hint or id_token_hint is required", "backchannel")
+		return UserProfile{}, false
+	}
+	hint := loginHint
+	if idTokenHint != "" {
+		subject, err := h.tokenService.ParseIDTokenHint(idTokenHint)
+		if err != nil {
+			writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "id_token_hint is invalid", "backchannel")
+			return UserProfile{}, false
+		}
+		hint = subject
+	}
+	user, err := h.lookupUser(hint)
+	if err != nil || user.ID == "" {
+		writeOAuthError(ctx, http.StatusBadRequest, "unknown_user_id", "the hinted user is not known", "backchannel")
+		return UserProfile{}, false
+	}
+	return user, true
+}
+
+func validBindingMessage(message string) bool {
+	if utf8.RuneCountInString(message) > backchannelBindingMaxLen {
+		return false
+	}
+	for _, r := range message {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *BackchannelHandler) HandlePending(ctx HTTPContext) {
+	user, err := h.resolveLoginUser(ctx)
+	if err != nil {
+		writeAuthorizeErrorPage(ctx, http.StatusUnauthorized, "login_required", "user not logged in")
+		return
+	}
+	h.renderPending(ctx, user, "")
+}
+
+func (h *BackchannelHandler) HandleDecision(ctx HTTPContext) {
+	user, err := h.resolveLoginUser(ctx)
+	if err != nil {
+		writeAuthorizeErrorPage(ctx, http.StatusUnauthorized, "login_required", "user not logged in")
+		return
+	}
+	now := h.nowFn()
+	record, err := h.store.GetBackchannelRequest(strings.TrimSpace(ctx.PostForm("id")), now)
+	if err != nil || !constantTimeEquals(record.UserID, user.ID) || record.Status != backchannelStatusPending {
+		writeAuthorizeErrorPage(ctx, http.StatusBadRequest, "invalid_request", "sign-in request is invalid or expired")
+		return
+	}
+	if record.DecisionToken == "" || !constantTimeEquals(record.DecisionToken, sha256Hex(ctx.PostForm("csrf_token"))) ||
+		!constantTimeEquals(record.DecisionSession, sha256Hex(user.SessionID)) {
+		writeAuthorizeErrorPage(ctx, http.StatusBadRequest, "invalid_request", "sign-in decision is not bound to this page")
+		return
+	}
+	record.DecisionToken = ""
+	record.DecisionSession = ""
+	notice := "The sign-in request was denied."
+	record.Status = backchannelStatusDenied
+	if ctx.PostForm("decision") == "approve" {
+		client, err := h.store.GetClient(record.ClientID)
+		if err != nil || !IsClientActive(client) {
+			writeAuthorizeErrorPage(ctx, http.StatusBadRequest, "unauthorized_client", "client is invalid")
+			return
+		}
+		user = resolveAuthentication(h.store, user, now)
+		record.Status = backchannelStatusApproved
+		record.AuthTime = user.AuthTime
+		record.AMR = user.AuthMethods
+		record.Roles = user.Roles
+		record.Groups = user.Groups
+		recordConsent(h.store, client, user.ID, record.Scope, nil)
+		notice = "The sign-in request was approved."
+	}
+	if err = h.store.SaveBackchannelRequest(record); err != nil {
+		writeAuthorizeErrorPage(ctx, http.StatusInternalServerError, "server_error", "failed to save decision")
+		return
+	}
+	h.renderPending(ctx, user, notice)
+}
+
+func (h *BackchannelHandler) renderPending(ctx HTTPContext, user UserProfile, notice string) {
+	data := backchannelPageData{Notice: notice}
+	for _, record := range h.store.ListBackchannelRequests(user.ID, h.nowFn()) {
+		clientName := record.ClientID
+		if client, err := h.store.GetClient(record.ClientID); err == nil && client.Name != "" {
+			clientName = client.Name
+		}
+		token, err := randomURLSafe(24)
+		if err == nil {
+			err = h.store.SetBackchannelDecisionToken(record.IDHash, sha256Hex(token), sha256Hex(user.SessionID))
+		}
+		if err != nil {
+			writeAuthorizeErrorPage(ctx, http.StatusInternalServerError, "server_error", "failed to render sign-in requests")
+			return
+		}
+		data.Requests = append(data.Requests, backchannelPageRequest{
+			ID:             record.IDHash,
+			Token:          token,
+			ClientName:     clientName,
+			Scopes:         record.Scope,
+			BindingMessage: record.BindingMessage,
+		})
+	}
+	page, err := renderBackchannelPage(data)
+	if err != nil {
+		writeAuthorizeErrorPage(ctx, http.StatusInternalServerError, "server_error", "failed to render sign-in requests")
+		return
+	}
+	ctx.HTML(http.StatusOK, page)
+}
+
+func (h *TokenHandler) handleBackchannelGrant(ctx HTTPContext) {
+	clientID := strings.TrimSpace(ctx.PostForm("client_id"))
+	clientSecret := strings.TrimSpace(ctx.PostForm("client_secret"))
+	authReqID := strings.TrimSpace(ctx.PostForm("auth_req_id"))
+	if clientID == "" || authReqID == "" {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "missing required parameters", "token")
+		return
+	}
+	client, err := h.store.ValidateClientSecret(clientID, clientSecret)
+	if err != nil {
+		writeOAuthError(ctx, http.StatusUnauthorized, "invalid_client", "client credentials are invalid", "token")
+		return
+	}
+	if !ClientAllowsGrantType(client, cibaGrantType) {
+		writeOAuthError(ctx, http.StatusBadRequest, "unauthorized_client", ErrUnsupportedGrantType.Error(), "token")
+		return
+	}
+	now := h.nowFn()
+	idHash := sha256Hex(authReqID)
+	record, err := h.store.GetBackchannelRequest(idHash, now)
+	if errors.Is(err, ErrBackchannelExpired) {
+		_ = h.store.DeleteBackchannelRequest(idHash)
+		writeOAuthError(ctx, http.StatusBadRequest, "expired_token", "auth_req_id has expired", "token")
+		return
+	}
+	if err != nil || !constantTimeEquals(record.ClientID, client.ID) {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_grant", "auth_req_id is invalid", "token")
+		return
+	}
+	switch record.Status {
+	case backchannelStatusDenied:
+		_ = h.store.DeleteBackchannelRequest(idHash)
+		writeOAuthError(ctx, http.StatusBadRequest, "access_denied", "user denied the authentication request", "token")
+	case backchannelStatusApproved:
+		if err = h.store.DeleteBackchannelRequest(idHash); err != nil {
+			writeOAuthError(ctx, http.StatusBadRequest, "invalid_grant", "auth_req_id is invalid", "token")
+			return
+		}
+		response, err := h.issueTokenResponse(client, tokenGrant{
+			UserID:   record.UserID,
+			Scope:    record.Scope,
+			AuthTime: record.AuthTime,
+			AMR:      record.AMR,
+			Roles:    record.Roles,
+			Groups:   record.Groups,
+		}, accessTarget{Scope: record.Scope})
+		if err != nil {
+			writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to issue tokens", "token")
+			return
+		}
+		ctx.JSON(http.StatusOK, response)
+	default:
+		tooFast := !record.LastPolledAt.IsZero() && now.Sub(record.LastPolledAt) < time.Duration(record.Interval)*time.Second
+		interval := record.Interval
+		if tooFast {
+			interval += backchannelSlowDownStep
+		}
+		if err = h.store.UpdateBackchannelPoll(idHash, now, interval); err != nil {
+			writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to update backchannel request", "token")
+			return
+		}
+		if tooFast {
+			writeOAuthError(ctx, http.StatusBadRequest, "slow_down", "polling too frequently", "token")
+			return
+		}
+		writeOAuthError(ctx, http.StatusBadRequest, "authorization_pending", "the user has not yet approved the request", "token")
+	}
+}
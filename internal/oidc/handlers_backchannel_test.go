@@ -0,0 +1,230 @@
+package oidc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackchannelAuthenticationPollFlow(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:                      "kiosk",
+		Name:                    "Support Kiosk",
+		Scopes:                  []string{"openid", "profile"},
+		GrantTypes:              []string{cibaGrantType},
+		TokenEndpointAuthMethod: "client_secret_post",
+		Status:                  "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	users := map[string]UserProfile{
+		"u_1": {ID: "u_1", Username: "alice", SessionID: "visit_1"},
+		"u_2": {ID: "u_2", Username: "bob"},
+	}
+	current := users["u_1"]
+	ts := newTestTokenService(t, DefaultConfig())
+	backchannel := NewBackchannelHandler(store, ts, func(hint string) (UserProfile, error) {
+		for _, user := range users {
+			if user.ID == hint || user.Username == hint {
+				return user, nil
+			}
+		}
+		return UserProfile{}, errors.New("user not found")
+	}, func(_ HTTPContext) (UserProfile, error) {
+		return current, nil
+	})
+	now := time.Now().UTC()
+	backchannel.nowFn = func() time.Time { return now }
+	token := NewTokenHandler(store, ts)
+	token.nowFn = func() time.Time { return now }
+
+	authenticate := func(form map[string]string) *fakeContext {
+		base := map[string]string{"client_id": "kiosk", "client_secret": "secret_1", "scope": "openid profile"}
+		for key, value := range form {
+			base[key] = value
+		}
+		ctx := &fakeContext{form: base}
+		backchannel.HandleAuthenticate(ctx)
+		return ctx
+	}
+	if ctx := authenticate(map[string]string{"login_hint": "mallory"}); mustOAuthError(ctx.jsonBody).Error != "unknown_user_id" {
+		t.Fatalf("expected unknown_user_id, got %s", mustJSON(ctx.jsonBody))
+	}
+	if ctx := authenticate(nil); mustOAuthError(ctx.jsonBody).Error != "invalid_request" {
+		t.Fatalf("expected missing hint to be rejected, got %s", mustJSON(ctx.jsonBody))
+	}
+	if ctx := authenticate(map[string]string{"login_hint": "alice", "binding_message": "line\nbreak"}); mustOAuthError(ctx.jsonBody).Error != "invalid_binding_message" {
+		t.Fatalf("expected invalid_binding_message, got %s", mustJSON(ctx.jsonBody))
+	}
+	started := authenticate(map[string]string{"login_hint": "alice", "binding_message": "K-42"})
+	body, ok := started.jsonBody.(map[string]any)
+	if !ok || started.statusCode != 200 || body["auth_req_id"] == "" || body["interval"] != backchannelPollInterval {
+		t.Fatalf("unexpected backchannel response: %d %s", started.statusCode, mustJSON(started.jsonBody))
+	}
+	authReqID := body["auth_req_id"].(string)
+
+	poll := func() *fakeContext {
+		ctx := &fakeContext{form: map[string]string{
+			"grant_type":    cibaGrantType,
+			"client_id":     "kiosk",
+			"client_secret": "secret_1",
+			"auth_req_id":   authReqID,
+		}}
+		token.Handle(ctx)
+		return ctx
+	}
+	if ctx := poll(); mustOAuthError(ctx.jsonBody).Error != "authorization_pending" {
+		t.Fatalf("expected authorization_pending, got %s", mustJSON(ctx.jsonBody))
+	}
+	if ctx := poll(); mustOAuthError(ctx.jsonBody).Error != "slow_down" {
+		t.Fatalf("expected slow_down, got %s", mustJSON(ctx.jsonBody))
+	}
+
+	page := &fakeContext{}
+	backchannel.HandlePending(page)
+	if !strings.Contains(page.htmlBody, "Support Kiosk") || !strings.Contains(page.htmlBody, "K-42") {
+		t.Fatalf("pending page must show the request, got %q", page.htmlBody)
+	}
+	requestID, csrfToken := backchannelFormFields(page.htmlBody)
+
+	forged := &fakeContext{form: map[string]string{"id": requestID, "decision": "approve"}}
+	backchannel.HandleDecision(forged)
+	if forged.statusCode != 400 {
+		t.Fatalf("a decision without the page token must be rejected, got %d", forged.statusCode)
+	}
+
+	current = UserProfile{ID: "u_1", Username: "alice", SessionID: "visit_2"}
+	otherSession := &fakeContext{form: map[string]string{"id": requestID, "csrf_token": csrfToken, "decision": "approve"}}
+	backchannel.HandleDecision(otherSession)
+	if otherSession.statusCode != 400 {
+		t.Fatalf("a decision from another session must be rejected, got %d", otherSession.statusCode)
+	}
+
+	current = users["u_2"]
+	foreign := &fakeContext{form: map[string]string{"id": requestID, "csrf_token": csrfToken, "decision": "approve"}}
+	backchannel.HandleDecision(foreign)
+	if foreign.statusCode != 400 {
+		t.Fatalf("another user must not approve the request, got %d", foreign.statusCode)
+	}
+
+	current = users["u_1"]
+	approved := &fakeContext{form: map[string]string{"id": requestID, "csrf_token": csrfToken, "decision": "approve"}}
+	backchannel.HandleDecision(approved)
+	if approved.statusCode != 200 || !strings.Contains(approved.htmlBody, "approved") {
+		t.Fatalf("expected approval page, got %d %q", approved.statusCode, approved.htmlBody)
+	}
+
+	now = now.Add(time.Minute)
+	issued := poll()
+	response, ok := issued.jsonBody.(TokenResponse)
+	if !ok || response.AccessToken == "" || response.IDToken == "" {
+		t.Fatalf("expected tokens after approval, got %s", mustJSON(issued.jsonBody))
+	}
+	if response.RefreshToken != "" {
+		t.Fatalf("client without refresh_token grant must not get a refresh token")
+	}
+	claims, err := ts.ParseAndValidateAccessToken(response.AccessToken)
+	if err != nil || claims["sub"] != "u_1" {
+		t.Fatalf("unexpected access token claims: %v err=%v", claims, err)
+	}
+	if ctx := poll(); mustOAuthError(ctx.jsonBody).Error != "invalid_grant" {
+		t.Fatalf("auth_req_id must be single use, got %s", mustJSON(ctx.jsonBody))
+	}
+	if _, err = store.GetConsent("kiosk", "u_1"); err != nil {
+		t.Fatalf("approval should record consent: %v", err)
+	}
+
+	denied := authenticate(map[string]string{"login_hint": "u_1", "requested_expiry": "60"})
+	authReqID = denied.jsonBody.(map[string]any)["auth_req_id"].(string)
+	if denied.jsonBody.(map[string]any)["expires_in"] != int64(60) {
+		t.Fatalf("requested_expiry should shorten the request: %s", mustJSON(denied.jsonBody))
+	}
+	page = &fakeContext{}
+	backchannel.HandlePending(page)
+	requestID, csrfToken = backchannelFormFields(page.htmlBody)
+	backchannel.HandleDecision(&fakeContext{form: map[string]string{"id": requestID, "csrf_token": csrfToken, "decision": "deny"}})
+	if ctx := poll(); mustOAuthError(ctx.jsonBody).Error != "access_denied" {
+		t.Fatalf("expected access_denied, got %s", mustJSON(ctx.jsonBody))
+	}
+
+	expiring := authenticate(map[string]string{"login_hint": "u_1", "requested_expiry": "30"})
+	authReqID = expiring.jsonBody.(map[string]any)["auth_req_id"].(string)
+	now = now.Add(time.Minute)
+	if ctx := poll(); mustOAuthError(ctx.jsonBody).Error != "expired_token" {
+		t.Fatalf("expected expired_token, got %s", mustJSON(ctx.jsonBody))
+	}
+}
+
+func backchannelFormFields(html string) (string, string) {
+	field := func(name string) string {
+		marker := `name="` + name + `" value="`
+		start := strings.Index(html, marker) + len(marker)
+		return html[start : start+strings.Index(html[start:], `"`)]
+	}
+	return field("id"), field("csrf_token")
+}
+
+type approveDuringPollStore struct {
+	Store
+	approve func()
+}
+
+func (s *approveDuringPollStore) GetBackchannelRequest(idHash string, now time.Time) (BackchannelAuthRequest, error) {
+	record, err := s.Store.GetBackchannelRequest(idHash, now)
+	if approve := s.approve; approve != nil {
+		s.approve = nil
+		approve()
+	}
+	return record, err
+}
+
+func TestBackchannelPollDoesNotOverwriteApproval(t *testing.T) {
+	base := NewInMemoryStore()
+	if _, _, err := base.CreateClient(OIDCClient{
+		ID:                      "kiosk",
+		Scopes:                  []string{"openid"},
+		GrantTypes:              []string{cibaGrantType},
+		TokenEndpointAuthMethod: "client_secret_post",
+		Status:                  "active",
+	}, "secret_1"); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	store := &approveDuringPollStore{Store: base}
+	user := UserProfile{ID: "u_1", Username: "alice"}
+	ts := newTestTokenService(t, DefaultConfig())
+	backchannel := NewBackchannelHandler(store, ts, func(_ string) (UserProfile, error) {
+		return user, nil
+	}, func(_ HTTPContext) (UserProfile, error) {
+		return user, nil
+	})
+	token := NewTokenHandler(store, ts)
+
+	started := &fakeContext{form: map[string]string{"client_id": "kiosk", "client_secret": "secret_1", "scope": "openid", "login_hint": "alice"}}
+	backchannel.HandleAuthenticate(started)
+	authReqID := started.jsonBody.(map[string]any)["auth_req_id"].(string)
+	poll := func() *fakeContext {
+		ctx := &fakeContext{form: map[string]string{"grant_type": cibaGrantType, "client_id": "kiosk", "client_secret": "secret_1", "auth_req_id": authReqID}}
+		token.Handle(ctx)
+		return ctx
+	}
+
+	page := &fakeContext{}
+	backchannel.HandlePending(page)
+	requestID, csrfToken := backchannelFormFields(page.htmlBody)
+	store.approve = func() {
+		backchannel.HandleDecision(&fakeContext{form: map[string]string{"id": requestID, "csrf_token": csrfToken, "decision": "approve"}})
+	}
+	if ctx := poll(); mustOAuthError(ctx.jsonBody).Error != "authorization_pending" {
+		t.Fatalf("poll that read the pending state should report authorization_pending, got %s", mustJSON(ctx.jsonBody))
+	}
+	record, err := base.GetBackchannelRequest(sha256Hex(authReqID), time.Now().UTC())
+	if err != nil || record.Status != backchannelStatusApproved {
+		t.Fatalf("concurrent poll must not overwrite the approval: %+v err=%v", record, err)
+	}
+	if response, ok := poll().jsonBody.(TokenResponse); !ok || response.AccessToken == "" {
+		t.Fatalf("expected tokens on the next poll")
+	}
+}
@@ -8,9 +8,14 @@ import (
 
 type HTTPContext interface {
 	Query(string) string
+	QueryArray(string) []string
 	PostForm(string) string
+	PostFormArray(string) []string
 	Header(string) string
+	SetHeader(string, string)
 	JSON(int, any)
+	Data(int, string, []byte)
+	HTML(int, string)
 	Redirect(int, string)
 	Status(int)
 	BindJSON(any) error
@@ -0,0 +1,53 @@
+package oidc
+
+import (
+	"net/http"
+	"time"
+)
+
+type ConnectedAppsHandler struct {
+	store       Store
+	resolveUser UserResolver
+}
+
+type connectedApp struct {
+	ClientID      string    `json:"client_id"`
+	ClientName    string    `json:"client_name"`
+	Scope         string    `json:"scope"`
+	FirstParty    bool      `json:"first_party"`
+	OfflineAccess bool      `json:"offline_access"`
+	GrantedAt     time.Time `json:"granted_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func NewConnectedAppsHandler(store Store, resolve UserResolver) *ConnectedAppsHandler {
+	return &ConnectedAppsHandler{store: store, resolveUser: resolve}
+}
+
+func (h *ConnectedAppsHandler) HandleList(ctx HTTPContext) {
+	user, err := h.resolveUser(ctx)
+	if err != nil {
+		writeOAuthError(ctx, http.StatusUnauthorized, "login_required", "user not logged in", "connected_apps")
+		return
+	}
+	apps := make([]connectedApp, 0)
+	for _, consent := range h.store.ListConsents(user.ID) {
+		if consent.RevokedAt != nil {
+			continue
+		}
+		client, err := h.store.GetClient(consent.ClientID)
+		if err != nil {
+			continue
+		}
+		apps = append(apps, connectedApp{
+			ClientID:      client.ID,
+			ClientName:    client.Name,
+			Scope:         joinScope(consent.Scope),
+			FirstParty:    consent.FirstParty,
+			OfflineAccess: consent.OfflineAccess,
+			GrantedAt:     consent.GrantedAt,
+			UpdatedAt:     consent.UpdatedAt,
+		})
+	}
+	ctx.JSON(http.StatusOK, map[string]any{"apps": apps})
+}
@@ -0,0 +1,47 @@
+package oidc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConnectedAppsShowOfflineAccess(t *testing.T) {
+	store := NewInMemoryStore()
+	for _, id := range []string{"client_1", "client_2"} {
+		if _, _, err := store.CreateClient(OIDCClient{ID: id, Name: id + "-name", Status: "active"}, "secret_1"); err != nil {
+			t.Fatalf("create client: %v", err)
+		}
+	}
+	_ = store.SaveConsent(ConsentRecord{ClientID: "client_1", UserID: "u_1", Scope: []string{"openid", "offline_access"}, OfflineAccess: true})
+	_ = store.SaveConsent(ConsentRecord{ClientID: "client_2", UserID: "u_1", Scope: []string{"openid"}})
+	_ = store.SaveConsent(ConsentRecord{ClientID: "client_2", UserID: "u_2", Scope: []string{"openid", "offline_access"}, OfflineAccess: true})
+
+	handler := NewConnectedAppsHandler(store, func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+	ctx := &fakeContext{}
+	handler.HandleList(ctx)
+	if ctx.statusCode != 200 {
+		t.Fatalf("expected 200, got %d", ctx.statusCode)
+	}
+	apps := ctx.jsonBody.(map[string]any)["apps"].([]connectedApp)
+	if len(apps) != 2 {
+		t.Fatalf("expected apps of the current user only, got %+v", apps)
+	}
+	offline := map[string]bool{}
+	for _, app := range apps {
+		offline[app.ClientID] = app.OfflineAccess
+	}
+	if !offline["client_1"] || offline["client_2"] {
+		t.Fatalf("unexpected offline access flags: %v", offline)
+	}
+
+	anonymous := NewConnectedAppsHandler(store, func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{}, errors.New("no login user")
+	})
+	ctx = &fakeContext{}
+	anonymous.HandleList(ctx)
+	if ctx.statusCode != 401 {
+		t.Fatalf("expected 401 without login, got %d", ctx.statusCode)
+	}
+}
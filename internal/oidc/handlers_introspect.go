@@ -0,0 +1,85 @@
+package oidc
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+type IntrospectHandler struct {
+	store        Store
+	tokenService *TokenService
+	nowFn        func() time.Time
+}
+
+func NewIntrospectHandler(store Store, tokenService *TokenService) *IntrospectHandler {
+	return &IntrospectHandler{
+		store:        store,
+		tokenService: tokenService,
+		nowFn:        func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (h *IntrospectHandler) Handle(ctx HTTPContext) {
+	token := strings.TrimSpace(ctx.PostForm("token"))
+	clientID := strings.TrimSpace(ctx.PostForm("client_id"))
+	clientSecret := strings.TrimSpace(ctx.PostForm("client_secret"))
+	if token == "" || clientID == "" {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "token and client_id are required", "introspect")
+		return
+	}
+	client, err := h.store.ValidateClientSecret(clientID, clientSecret)
+	if err != nil || !containsValue(supportedIntrospectionAuthMethods, client.TokenEndpointAuthMethod) {
+		writeOAuthError(ctx, http.StatusUnauthorized, "invalid_client", "client credentials are invalid", "introspect")
+		return
+	}
+
+	now := h.nowFn()
+	if record, err := h.store.GetRefreshToken(token, now); err == nil {
+		if !constantTimeEquals(record.ClientID, client.ID) {
+			ctx.JSON(http.StatusOK, map[string]any{"active": false})
+			return
+		}
+		response := map[string]any{
+			"active":     true,
+			"token_type": "refresh_token",
+			"iss":        h.tokenService.Issuer(),
+			"sub":        record.UserID,
+			"client_id":  record.ClientID,
+			"scope":      joinScope(record.Scope),
+			"iat":        record.CreatedAt.Unix(),
+			"exp":        record.ExpiresAt.Unix(),
+		}
+		if len(record.AuthorizationDetails) > 0 {
+			response["authorization_details"] = record.AuthorizationDetails
+		}
+		ctx.JSON(http.StatusOK, response)
+		return
+	}
+
+	claims, err := validateAccessToken(h.store, h.tokenService, token, now)
+	if err != nil {
+		ctx.JSON(http.StatusOK, map[string]any{"active": false})
+		return
+	}
+	owner := tokenClientID(claims)
+	if !constantTimeEquals(owner, client.ID) && !isTokenResourceClient(h.store, claims, client.ID) {
+		ctx.JSON(http.StatusOK, map[string]any{"active": false})
+		return
+	}
+	response := map[string]any{
+		"active":     true,
+		"token_type": "Bearer",
+		"iss":        claims["iss"],
+		"sub":        claims["sub"],
+		"aud":        claims["aud"],
+		"client_id":  owner,
+		"scope":      claims["scope"],
+		"iat":        claims["iat"],
+		"exp":        claims["exp"],
+	}
+	if details, ok := claims["authorization_details"]; ok {
+		response["authorization_details"] = details
+	}
+	ctx.JSON(http.StatusOK, response)
+}
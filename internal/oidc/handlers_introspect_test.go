@@ -0,0 +1,176 @@
+package oidc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newOpaqueTestStore(t *testing.T) *InMemoryStore {
+	t.Helper()
+	store := NewInMemoryStore()
+	for _, id := range []string{"client_1", "client_2"} {
+		_, _, err := store.CreateClient(OIDCClient{
+			ID:                      id,
+			Name:                    id,
+			RedirectURIs:            []string{"https://client.example.com/callback"},
+			Scopes:                  []string{"openid", "profile"},
+			GrantTypes:              []string{"authorization_code", "refresh_token"},
+			TokenEndpointAuthMethod: "client_secret_post",
+			AccessTokenFormat:       "opaque",
+			Status:                  "active",
+		}, "secret_1")
+		if err != nil {
+			t.Fatalf("create client: %v", err)
+		}
+	}
+	return store
+}
+
+func TestOpaqueAccessTokenLifecycle(t *testing.T) {
+	store := newOpaqueTestStore(t)
+	config := DefaultConfig()
+	config.Issuer = "https://answer.example.com"
+	ts := newTestTokenService(t, config)
+
+	rawCode := "auth_code_opaque"
+	if err := store.SaveAuthCode(AuthCodeRecord{
+		CodeHash:      sha256Hex(rawCode),
+		ClientID:      "client_1",
+		UserID:        "u_1",
+		RedirectURI:   "https://client.example.com/callback",
+		Scope:         []string{"openid", "profile"},
+		CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		CodeMethod:    "S256",
+		ExpiresAt:     time.Now().UTC().Add(5 * time.Minute),
+	}); err != nil {
+		t.Fatalf("save auth code: %v", err)
+	}
+	tokenCtx := &fakeContext{form: map[string]string{
+		"grant_type":    "authorization_code",
+		"client_id":     "client_1",
+		"client_secret": "secret_1",
+		"code":          rawCode,
+		"redirect_uri":  "https://client.example.com/callback",
+		"code_verifier": "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk",
+	}}
+	NewTokenHandler(store, ts).Handle(tokenCtx)
+	response, ok := tokenCtx.jsonBody.(TokenResponse)
+	if !ok {
+		t.Fatalf("expected token response, got %s", mustJSON(tokenCtx.jsonBody))
+	}
+	if strings.Contains(response.AccessToken, ".") {
+		t.Fatalf("expected opaque access token, got %s", response.AccessToken)
+	}
+
+	userinfo := NewUserInfoHandler(store, ts, func(userID string) (UserProfile, error) {
+		return UserProfile{ID: userID}, nil
+	})
+	ctx := &fakeContext{headers: map[string]string{"Authorization": "Bearer " + response.AccessToken}}
+	userinfo.Handle(ctx)
+	if ctx.statusCode != 200 {
+		t.Fatalf("expected userinfo to accept opaque token, got %d", ctx.statusCode)
+	}
+
+	introspect := NewIntrospectHandler(store, ts)
+	ctx = &fakeContext{form: map[string]string{"token": response.AccessToken, "client_id": "client_1", "client_secret": "secret_1"}}
+	introspect.Handle(ctx)
+	body := ctx.jsonBody.(map[string]any)
+	if body["active"] != true || body["sub"] != "u_1" || body["scope"] != "openid profile" {
+		t.Fatalf("unexpected introspection: %s", mustJSON(body))
+	}
+
+	ctx = &fakeContext{form: map[string]string{"token": response.AccessToken, "client_id": "client_2", "client_secret": "secret_1"}}
+	introspect.Handle(ctx)
+	if body := ctx.jsonBody.(map[string]any); body["active"] != false || len(body) != 1 {
+		t.Fatalf("other clients must not see token details: %s", mustJSON(body))
+	}
+
+	ctx = &fakeContext{form: map[string]string{"token": response.AccessToken, "client_id": "client_1", "client_secret": "secret_1"}}
+	NewRevokeHandler(store, ts).Handle(ctx)
+	if ctx.statusCode != 200 {
+		t.Fatalf("expected revoke 200, got %d", ctx.statusCode)
+	}
+
+	ctx = &fakeContext{headers: map[string]string{"Authorization": "Bearer " + response.AccessToken}}
+	userinfo.Handle(ctx)
+	if ctx.statusCode != 401 {
+		t.Fatalf("expected revoked token to be rejected, got %d", ctx.statusCode)
+	}
+	ctx = &fakeContext{form: map[string]string{"token": response.AccessToken, "client_id": "client_1", "client_secret": "secret_1"}}
+	introspect.Handle(ctx)
+	if body := ctx.jsonBody.(map[string]any); body["active"] != false {
+		t.Fatalf("expected inactive after revoke: %s", mustJSON(body))
+	}
+}
+
+func TestIntrospectByLinkedResourceClient(t *testing.T) {
+	store := newOpaqueTestStore(t)
+	if _, _, err := store.CreateClient(OIDCClient{
+		ID:                      "spa_1",
+		Name:                    "spa_1",
+		RedirectURIs:            []string{"https://spa.example.com/callback"},
+		Scopes:                  []string{"openid"},
+		GrantTypes:              []string{"authorization_code"},
+		TokenEndpointAuthMethod: "none",
+		Status:                  "active",
+	}, ""); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	admin := NewAdminResourceHandler(store)
+	public := &fakeContext{bindBody: []byte(`{"uri":"https://api.example.com","scopes":["api.read"],"client_id":"spa_1"}`)}
+	admin.HandleSave(public)
+	if public.statusCode != 400 {
+		t.Fatalf("expected public client link to be rejected, got %d", public.statusCode)
+	}
+	linked := &fakeContext{bindBody: []byte(`{"uri":"https://api.example.com","scopes":["api.read"],"client_id":"client_2"}`)}
+	admin.HandleSave(linked)
+	if linked.statusCode != 200 {
+		t.Fatalf("expected 200, got %d %s", linked.statusCode, mustJSON(linked.jsonBody))
+	}
+
+	ts := newTestTokenService(t, DefaultConfig())
+	now := time.Now().UTC()
+	issue := func(resources []string) string {
+		token, _, err := ts.IssueAccessToken(AccessTokenClaims{
+			Audience:  "client_1",
+			ClientID:  "client_1",
+			Resources: resources,
+			Subject:   "u_1",
+			Scope:     []string{"api.read"},
+			IssuedAt:  now,
+			ExpiresAt: now.Add(5 * time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("issue access token: %v", err)
+		}
+		return token
+	}
+	introspect := func(token, clientID string) map[string]any {
+		ctx := &fakeContext{form: map[string]string{"token": token, "client_id": clientID, "client_secret": "secret_1"}}
+		NewIntrospectHandler(store, ts).Handle(ctx)
+		return ctx.jsonBody.(map[string]any)
+	}
+
+	apiToken := issue([]string{"https://api.example.com"})
+	if body := introspect(apiToken, "client_2"); body["active"] != true || body["client_id"] != "client_1" || body["aud"] != "https://api.example.com" {
+		t.Fatalf("expected linked resource client to introspect, got %s", mustJSON(body))
+	}
+	if body := introspect(apiToken, "client_1"); body["active"] != true {
+		t.Fatalf("expected owning client to introspect, got %s", mustJSON(body))
+	}
+	if body := introspect(issue(nil), "client_2"); body["active"] != false {
+		t.Fatalf("expected token without the resource to stay inactive, got %s", mustJSON(body))
+	}
+
+	publicCaller := &fakeContext{form: map[string]string{"token": apiToken, "client_id": "spa_1"}}
+	NewIntrospectHandler(store, ts).Handle(publicCaller)
+	if publicCaller.statusCode != 401 || mustOAuthError(publicCaller.jsonBody).Error != "invalid_client" {
+		t.Fatalf("expected public client to be rejected, got %d %s", publicCaller.statusCode, mustJSON(publicCaller.jsonBody))
+	}
+	discovery := &fakeContext{}
+	NewMetadataHandler(DefaultConfig(), ts.keyService).HandleDiscovery(discovery)
+	if !strings.Contains(string(discovery.dataBody), `"introspection_endpoint_auth_methods_supported":["client_secret_post"]`) {
+		t.Fatalf("unexpected introspection auth methods: %s", discovery.dataBody)
+	}
+}
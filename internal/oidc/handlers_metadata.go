@@ -1,42 +1,115 @@
 package oidc
 
 import (
-	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
+const webFingerIssuerRel = "http://openid.net/specs/connect/1.0/issuer"
+
 type MetadataHandler struct {
 	config     Config
 	keyService *KeyService
+	discovery  cachedDocument
+	oauth      cachedDocument
+	jwks       cachedDocument
 }
 
 func NewMetadataHandler(config Config, keyService *KeyService) *MetadataHandler {
-	return &MetadataHandler{
+	h := &MetadataHandler{
 		config:     config.normalize(),
 		keyService: keyService,
 	}
+	h.discovery = newCachedDocument(h.discoveryMetadata(), metadataCacheMaxAge)
+	h.oauth = newCachedDocument(h.serverMetadata(), metadataCacheMaxAge)
+	h.jwks = newCachedDocument(keyService.JWKS(), h.config.JWKSCacheMaxAge)
+	return h
 }
 
 func (h *MetadataHandler) HandleDiscovery(ctx HTTPContext) {
-	base := strings.TrimRight(h.config.BasePath, "/")
+	h.discovery.serve(ctx, "discovery")
+}
+
+func (h *MetadataHandler) HandleAuthorizationServerMetadata(ctx HTTPContext) {
+	h.oauth.serve(ctx, "discovery")
+}
+
+func (h *MetadataHandler) HandleWebFinger(ctx HTTPContext) {
+	resource := strings.TrimSpace(ctx.Query("resource"))
+	if resource == "" {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_request", "resource is required", "webfinger")
+		return
+	}
+	if !h.ownsResource(resource) {
+		writeOAuthError(ctx, http.StatusNotFound, "invalid_request", "resource is not served by this issuer", "webfinger")
+		return
+	}
+	links := []map[string]string{}
+	if rel := strings.TrimSpace(ctx.Query("rel")); rel == "" || rel == webFingerIssuerRel {
+		links = append(links, map[string]string{"rel": webFingerIssuerRel, "href": h.config.issuerURL()})
+	}
 	ctx.JSON(http.StatusOK, map[string]any{
-		"issuer":                                h.config.Issuer,
-		"authorization_endpoint":                fmt.Sprintf("%s%s/authorize", h.config.Issuer, base),
-		"token_endpoint":                        fmt.Sprintf("%s%s/token", h.config.Issuer, base),
-		"userinfo_endpoint":                     fmt.Sprintf("%s%s/userinfo", h.config.Issuer, base),
-		"jwks_uri":                              fmt.Sprintf("%s%s/.well-known/jwks.json", h.config.Issuer, base),
-		"response_types_supported":              []string{"code"},
-		"subject_types_supported":               []string{"public"},
-		"id_token_signing_alg_values_supported": []string{"RS256"},
-		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
-		"scopes_supported":                      h.config.DefaultScopes,
-		"token_endpoint_auth_methods_supported": []string{"client_secret_post", "none"},
-		"code_challenge_methods_supported":      []string{"S256"},
-		"revocation_endpoint":                   fmt.Sprintf("%s%s/revoke", h.config.Issuer, base),
+		"subject": resource,
+		"links":   links,
 	})
 }
 
 func (h *MetadataHandler) HandleJWKS(ctx HTTPContext) {
-	ctx.JSON(http.StatusOK, h.keyService.JWKS())
+	h.jwks.serve(ctx, "jwks")
+}
+
+func (h *MetadataHandler) discoveryMetadata() map[string]any {
+	metadata := h.serverMetadata()
+	metadata["userinfo_endpoint"] = h.endpoint("/userinfo")
+	metadata["subject_types_supported"] = supportedSubjectTypes
+	metadata["id_token_signing_alg_values_supported"] = supportedIDTokenSigningAlgs
+	metadata["acr_values_supported"] = supportedACRValues
+	metadata["claims_supported"] = supportedClaims
+	return metadata
+}
+
+func (h *MetadataHandler) serverMetadata() map[string]any {
+	return map[string]any{
+		"issuer":                                         h.config.issuerURL(),
+		"authorization_endpoint":                         h.endpoint("/authorize"),
+		"token_endpoint":                                 h.endpoint("/token"),
+		"jwks_uri":                                       h.endpoint("/.well-known/jwks.json"),
+		"revocation_endpoint":                            h.endpoint("/revoke"),
+		"introspection_endpoint":                         h.endpoint("/introspect"),
+		"response_types_supported":                       supportedResponseTypes,
+		"response_modes_supported":                       supportedResponseModes,
+		"grant_types_supported":                          supportedGrantTypes,
+		"scopes_supported":                               h.config.DefaultScopes,
+		"token_endpoint_auth_methods_supported":          supportedTokenEndpointAuthMethods,
+		"revocation_endpoint_auth_methods_supported":     supportedTokenEndpointAuthMethods,
+		"introspection_endpoint_auth_methods_supported":  supportedIntrospectionAuthMethods,
+		"code_challenge_methods_supported":               supportedCodeChallengeMethods,
+		"authorization_signing_alg_values_supported":     supportedAuthorizationSigningAlgs,
+		"authorization_response_iss_parameter_supported": true,
+		"prompt_values_supported":                        supportedPromptValues,
+		"backchannel_authentication_endpoint":            h.endpoint("/bc-authorize"),
+		"backchannel_token_delivery_modes_supported":     supportedBackchannelDeliveryModes,
+		"backchannel_user_code_parameter_supported":      false,
+	}
+}
+
+func (h *MetadataHandler) endpoint(path string) string {
+	return h.config.endpointURL(path)
+}
+
+func (h *MetadataHandler) ownsResource(resource string) bool {
+	issuer, err := url.Parse(h.config.issuerURL())
+	if err != nil {
+		return false
+	}
+	if account, ok := strings.CutPrefix(resource, "acct:"); ok {
+		at := strings.LastIndex(account, "@")
+		return at > 0 && strings.EqualFold(account[at+1:], issuer.Host)
+	}
+	target, err := url.Parse(resource)
+	if err != nil || target.Host == "" {
+		return false
+	}
+	return strings.EqualFold(target.Host, issuer.Host)
 }
@@ -1,10 +1,13 @@
 package oidc
 
 import (
+	"errors"
 	"net/url"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func TestAuthorizeReturnsCodeWhenPKCEValid(t *testing.T) {
@@ -21,7 +24,7 @@ func TestAuthorizeReturnsCodeWhenPKCEValid(t *testing.T) {
 		t.Fatalf("create client: %v", err)
 	}
 
-	handler := NewAuthorizeHandler(store, DefaultConfig(), func(_ HTTPContext) (UserProfile, error) {
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
 		return UserProfile{ID: "u_1"}, nil
 	})
 	ctx := &fakeContext{
@@ -74,7 +77,7 @@ func TestTokenExchangeSucceedsWithVerifier(t *testing.T) {
 		ClientID:      "client_1",
 		UserID:        "u_1",
 		RedirectURI:   "https://client.example.com/callback",
-		Scope:         []string{"openid", "profile"},
+		Scope:         []string{"openid", "profile", "offline_access"},
 		CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
 		CodeMethod:    "S256",
 		ExpiresAt:     time.Now().UTC().Add(5 * time.Minute),
@@ -245,7 +248,7 @@ func TestAuthorizeSavesConsent(t *testing.T) {
 		t.Fatalf("create client: %v", err)
 	}
 
-	handler := NewAuthorizeHandler(store, DefaultConfig(), func(_ HTTPContext) (UserProfile, error) {
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
 		return UserProfile{ID: "u_1"}, nil
 	})
 	ctx := &fakeContext{query: map[string]string{
@@ -386,7 +389,7 @@ func TestAuthorizeRejectsUnsupportedGrantType(t *testing.T) {
 		t.Fatalf("create client: %v", err)
 	}
 
-	handler := NewAuthorizeHandler(store, DefaultConfig(), func(_ HTTPContext) (UserProfile, error) {
+	handler := NewAuthorizeHandler(store, DefaultConfig(), newTestTokenService(t, DefaultConfig()), func(_ HTTPContext) (UserProfile, error) {
 		return UserProfile{ID: "u_1"}, nil
 	})
 	ctx := &fakeContext{query: map[string]string{
@@ -401,11 +404,570 @@ func TestAuthorizeRejectsUnsupportedGrantType(t *testing.T) {
 	}}
 	handler.Handle(ctx)
 
-	if ctx.statusCode != 400 {
-		t.Fatalf("expected 400, got %d body=%s", ctx.statusCode, mustJSON(ctx.jsonBody))
+	if ctx.statusCode != 302 {
+		t.Fatalf("expected error redirect, got %d body=%s", ctx.statusCode, mustJSON(ctx.jsonBody))
 	}
-	payload := mustOAuthError(ctx.jsonBody)
-	if payload.Error != "unauthorized_client" {
-		t.Fatalf("expected unauthorized_client, got %s", payload.Error)
+	u, err := url.Parse(ctx.redirect)
+	if err != nil {
+		t.Fatalf("parse redirect uri: %v", err)
+	}
+	if u.Query().Get("error") != "unauthorized_client" || u.Query().Get("state") != "state-1" {
+		t.Fatalf("unexpected error redirect: %s", ctx.redirect)
+	}
+}
+
+func TestAuthorizeRedirectsToLoginAndResumes(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:           "client_1",
+		Name:         "client-1",
+		RedirectURIs: []string{"https://client.example.com/callback"},
+		Scopes:       []string{"openid", "profile"},
+		GrantTypes:   []string{"authorization_code", "refresh_token"},
+		Status:       "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+
+	loggedIn := false
+	config := DefaultConfig()
+	config.Issuer = "https://answer.example.com"
+	handler := NewAuthorizeHandler(store, config, newTestTokenService(t, config), func(_ HTTPContext) (UserProfile, error) {
+		if !loggedIn {
+			return UserProfile{}, errors.New("no login user")
+		}
+		return UserProfile{ID: "u_1"}, nil
+	})
+	ctx := &fakeContext{query: map[string]string{
+		"response_type":         "code",
+		"client_id":             "client_1",
+		"redirect_uri":          "https://client.example.com/callback",
+		"scope":                 "openid profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		"code_challenge_method": "S256",
+	}}
+	handler.Handle(ctx)
+
+	if ctx.statusCode != 302 {
+		t.Fatalf("expected login redirect, got %d body=%s", ctx.statusCode, mustJSON(ctx.jsonBody))
+	}
+	loginURL, err := url.Parse(ctx.redirect)
+	if err != nil {
+		t.Fatalf("parse login redirect: %v", err)
+	}
+	if loginURL.Path != "/users/login" {
+		t.Fatalf("unexpected login path: %s", ctx.redirect)
+	}
+	returnTo, err := url.Parse(loginURL.Query().Get("redirect"))
+	if err != nil {
+		t.Fatalf("parse return url: %v", err)
+	}
+	txnID := returnTo.Query().Get("txn")
+	if txnID == "" || !strings.HasPrefix(returnTo.String(), "http://localhost:8080/answer/api/v1/api/auth/oidc/authorize") {
+		t.Fatalf("unexpected return url: %s", returnTo.String())
+	}
+
+	loggedIn = true
+	resumed := &fakeContext{query: map[string]string{"txn": txnID}}
+	handler.Handle(resumed)
+
+	if resumed.statusCode != 302 {
+		t.Fatalf("expected callback redirect, got %d body=%s", resumed.statusCode, mustJSON(resumed.jsonBody))
+	}
+	callback, err := url.Parse(resumed.redirect)
+	if err != nil {
+		t.Fatalf("parse callback: %v", err)
+	}
+	if callback.Query().Get("state") != "state-1" || callback.Query().Get("code") == "" {
+		t.Fatalf("unexpected callback: %s", resumed.redirect)
+	}
+	record, err := store.ConsumeAuthCode(callback.Query().Get("code"), time.Now().UTC())
+	if err != nil {
+		t.Fatalf("consume resumed code: %v", err)
+	}
+	if record.Nonce != "nonce-1" || record.CodeChallenge != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Fatalf("resumed code lost request parameters: %+v", record)
+	}
+	if _, err = store.GetAuthorizeTransaction(txnID, time.Now().UTC()); err == nil {
+		t.Fatalf("authorization request should be removed after resume")
+	}
+}
+
+func TestTokenExchangeCarriesAuthenticationContext(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:                      "client_1",
+		Name:                    "client-1",
+		RedirectURIs:            []string{"https://client.example.com/callback"},
+		Scopes:                  []string{"openid", "profile"},
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		TokenEndpointAuthMethod: "client_secret_post",
+		Status:                  "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+
+	authTime := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	rawCode := "auth_code_ctx"
+	err = store.SaveAuthCode(AuthCodeRecord{
+		CodeHash:      sha256Hex(rawCode),
+		ClientID:      "client_1",
+		UserID:        "u_1",
+		RedirectURI:   "https://client.example.com/callback",
+		Scope:         []string{"openid", "profile", "offline_access"},
+		CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		CodeMethod:    "S256",
+		ExpiresAt:     time.Now().UTC().Add(5 * time.Minute),
+		AuthTime:      authTime,
+		ACR:           acrFederated,
+		AMR:           []string{"fed"},
+	})
+	if err != nil {
+		t.Fatalf("save auth code: %v", err)
+	}
+
+	ks, err := NewKeyService("")
+	if err != nil {
+		t.Fatalf("new key service: %v", err)
+	}
+	config := DefaultConfig()
+	config.Issuer = "https://answer.example.com"
+	handler := NewTokenHandler(store, NewTokenService(config, ks))
+	ctx := &fakeContext{form: map[string]string{
+		"grant_type":    "authorization_code",
+		"client_id":     "client_1",
+		"client_secret": "secret_1",
+		"code":          rawCode,
+		"redirect_uri":  "https://client.example.com/callback",
+		"code_verifier": "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk",
+	}}
+	handler.Handle(ctx)
+
+	response, ok := ctx.jsonBody.(TokenResponse)
+	if !ok {
+		t.Fatalf("expected token response, got %T body=%s", ctx.jsonBody, mustJSON(ctx.jsonBody))
+	}
+	claims := jwt.MapClaims{}
+	if _, err = jwt.ParseWithClaims(response.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return ks.PublicKey(), nil
+	}); err != nil {
+		t.Fatalf("parse id token: %v", err)
+	}
+	if int64(claims["auth_time"].(float64)) != authTime.Unix() {
+		t.Fatalf("unexpected auth_time: %v", claims["auth_time"])
+	}
+	if claims["acr"] != acrFederated {
+		t.Fatalf("unexpected acr: %v", claims["acr"])
+	}
+
+	refresh, err := store.GetRefreshToken(response.RefreshToken, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("get refresh token: %v", err)
+	}
+	if !refresh.AuthTime.Equal(authTime) || refresh.ACR != acrFederated {
+		t.Fatalf("refresh token lost authentication context: %+v", refresh)
+	}
+}
+
+func TestTokenExchangeRejectsCodeFromOtherIssuer(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:                      "client_1",
+		Name:                    "client-1",
+		RedirectURIs:            []string{"https://client.example.com/callback"},
+		Scopes:                  []string{"openid", "profile"},
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		TokenEndpointAuthMethod: "client_secret_post",
+		Status:                  "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+
+	rawCode := "auth_code_iss"
+	err = store.SaveAuthCode(AuthCodeRecord{
+		CodeHash:      sha256Hex(rawCode),
+		ClientID:      "client_1",
+		UserID:        "u_1",
+		RedirectURI:   "https://client.example.com/callback",
+		Scope:         []string{"openid", "profile"},
+		CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		CodeMethod:    "S256",
+		Issuer:        "https://other.example.com",
+		ExpiresAt:     time.Now().UTC().Add(5 * time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("save auth code: %v", err)
+	}
+
+	config := DefaultConfig()
+	config.Issuer = "https://answer.example.com"
+	handler := NewTokenHandler(store, newTestTokenService(t, config))
+	ctx := &fakeContext{form: map[string]string{
+		"grant_type":    "authorization_code",
+		"client_id":     "client_1",
+		"client_secret": "secret_1",
+		"code":          rawCode,
+		"redirect_uri":  "https://client.example.com/callback",
+		"code_verifier": "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk",
+	}}
+	handler.Handle(ctx)
+
+	if ctx.statusCode != 400 || !strings.Contains(mustJSON(ctx.jsonBody), "invalid_grant") {
+		t.Fatalf("expected invalid_grant, got %d body=%s", ctx.statusCode, mustJSON(ctx.jsonBody))
+	}
+}
+
+func TestRefreshTokenReplayRevokesFamily(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:                      "client_1",
+		Name:                    "client-1",
+		RedirectURIs:            []string{"https://client.example.com/callback"},
+		Scopes:                  []string{"openid", "profile"},
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		TokenEndpointAuthMethod: "client_secret_post",
+		Status:                  "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	original := "refresh_family"
+	err = store.SaveRefreshToken(RefreshTokenRecord{
+		TokenHash: sha256Hex(original),
+		FamilyID:  "family_1",
+		ClientID:  "client_1",
+		UserID:    "u_1",
+		Scope:     []string{"openid", "profile"},
+		ExpiresAt: time.Now().UTC().Add(2 * time.Hour),
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("save refresh token: %v", err)
+	}
+
+	handler := NewTokenHandler(store, newTestTokenService(t, DefaultConfig()))
+	refresh := func(token string) *fakeContext {
+		ctx := &fakeContext{form: map[string]string{
+			"grant_type":    "refresh_token",
+			"client_id":     "client_1",
+			"client_secret": "secret_1",
+			"refresh_token": token,
+		}}
+		handler.Handle(ctx)
+		return ctx
+	}
+
+	rotated := refresh(original)
+	successor := rotated.jsonBody.(TokenResponse).RefreshToken
+	record, err := store.GetRefreshToken(successor, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("get successor: %v", err)
+	}
+	if record.FamilyID != "family_1" || record.RotatedFrom != sha256Hex(original) {
+		t.Fatalf("unexpected successor lineage: family=%s rotated_from=%s", record.FamilyID, record.RotatedFrom)
+	}
+
+	replay := refresh(original)
+	if replay.statusCode != 400 || mustOAuthError(replay.jsonBody).Error != "invalid_grant" {
+		t.Fatalf("expected invalid_grant on replay, got %d %s", replay.statusCode, mustJSON(replay.jsonBody))
+	}
+	if _, err = store.GetRefreshToken(successor, time.Now().UTC()); !errors.Is(err, ErrRefreshTokenRevoked) {
+		t.Fatalf("expected successor to be revoked after replay, got %v", err)
+	}
+	events := store.ListSecurityEvents()
+	if len(events) != 1 || events[0].Type != "refresh_token_replay" || events[0].FamilyID != "family_1" {
+		t.Fatalf("unexpected security events: %s", mustJSON(events))
+	}
+}
+
+func TestRefreshTokenReuseWithinGraceIssuesSibling(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:                      "client_1",
+		Name:                    "client-1",
+		RedirectURIs:            []string{"https://client.example.com/callback"},
+		Scopes:                  []string{"openid", "profile"},
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		TokenEndpointAuthMethod: "client_secret_post",
+		Status:                  "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	original := "refresh_grace"
+	err = store.SaveRefreshToken(RefreshTokenRecord{
+		TokenHash: sha256Hex(original),
+		FamilyID:  "family_1",
+		ClientID:  "client_1",
+		UserID:    "u_1",
+		Scope:     []string{"openid", "profile"},
+		ExpiresAt: time.Now().UTC().Add(2 * time.Hour),
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("save refresh token: %v", err)
+	}
+
+	config := DefaultConfig()
+	config.RefreshReuseGrace = 5 * time.Second
+	handler := NewTokenHandler(store, newTestTokenService(t, config))
+	now := time.Now().UTC()
+	handler.nowFn = func() time.Time { return now }
+	refresh := func(token string) *fakeContext {
+		ctx := &fakeContext{form: map[string]string{
+			"grant_type":    "refresh_token",
+			"client_id":     "client_1",
+			"client_secret": "secret_1",
+			"refresh_token": token,
+		}}
+		handler.Handle(ctx)
+		return ctx
+	}
+
+	first := refresh(original).jsonBody.(TokenResponse).RefreshToken
+	concurrent := refresh(original)
+	if concurrent.statusCode != 200 {
+		t.Fatalf("expected reuse within grace to succeed, got %d %s", concurrent.statusCode, mustJSON(concurrent.jsonBody))
+	}
+	sibling := concurrent.jsonBody.(TokenResponse).RefreshToken
+	for _, token := range []string{first, sibling} {
+		record, err := store.GetRefreshToken(token, now)
+		if err != nil || record.FamilyID != "family_1" {
+			t.Fatalf("expected active token in family, got %+v err=%v", record, err)
+		}
+	}
+
+	now = now.Add(10 * time.Second)
+	if replay := refresh(original); replay.statusCode != 400 {
+		t.Fatalf("expected replay outside grace to fail, got %d", replay.statusCode)
+	}
+	if _, err = store.GetRefreshToken(sibling, now); !errors.Is(err, ErrRefreshTokenRevoked) {
+		t.Fatalf("expected family revoked after replay, got %v", err)
+	}
+}
+
+func TestRefreshTokenIdleAndAbsoluteLifetimes(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:                             "client_1",
+		Name:                           "client-1",
+		RedirectURIs:                   []string{"https://client.example.com/callback"},
+		Scopes:                         []string{"openid"},
+		GrantTypes:                     []string{"authorization_code", "refresh_token"},
+		TokenEndpointAuthMethod:        "client_secret_post",
+		RefreshTokenMaxLifetimeSeconds: int64((3 * time.Hour) / time.Second),
+		Status:                         "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	client, _ := store.GetClient("client_1")
+
+	config := DefaultConfig()
+	config.RefreshTokenTTL = 2 * time.Hour
+	config.RefreshTokenMaxLifetime = 24 * time.Hour
+	ts := newTestTokenService(t, config)
+	now := time.Now().UTC()
+	ts.nowFn = func() time.Time { return now }
+	handler := NewTokenHandler(store, ts)
+	handler.nowFn = func() time.Time { return now }
+
+	raw, record, err := ts.NewRefreshToken(client, time.Time{})
+	if err != nil {
+		t.Fatalf("new refresh token: %v", err)
+	}
+	record.FamilyID = record.TokenHash
+	record.UserID = "u_1"
+	record.Scope = []string{"openid"}
+	if err = store.SaveRefreshToken(record); err != nil {
+		t.Fatalf("save refresh token: %v", err)
+	}
+	if !record.MaxExpiresAt.Equal(now.Add(3*time.Hour)) || !record.ExpiresAt.Equal(now.Add(2*time.Hour)) {
+		t.Fatalf("unexpected lifetimes: expires=%v max=%v", record.ExpiresAt, record.MaxExpiresAt)
+	}
+
+	refresh := func(token string) *fakeContext {
+		ctx := &fakeContext{form: map[string]string{
+			"grant_type":    "refresh_token",
+			"client_id":     "client_1",
+			"client_secret": "secret_1",
+			"refresh_token": token,
+		}}
+		handler.Handle(ctx)
+		return ctx
+	}
+
+	now = now.Add(90 * time.Minute)
+	ctx := refresh(raw)
+	if ctx.statusCode != 200 {
+		t.Fatalf("expected refresh within idle timeout to succeed, got %d %s", ctx.statusCode, mustJSON(ctx.jsonBody))
+	}
+	response := ctx.jsonBody.(TokenResponse)
+	if response.RefreshExpiresIn != int64((90*time.Minute)/time.Second) {
+		t.Fatalf("expected rotation capped by absolute lifetime, got %d", response.RefreshExpiresIn)
+	}
+
+	now = now.Add(91 * time.Minute)
+	if expired := refresh(response.RefreshToken); expired.statusCode != 400 {
+		t.Fatalf("expected refresh past absolute lifetime to fail, got %d", expired.statusCode)
+	}
+
+	raw, record, err = ts.NewRefreshToken(OIDCClient{ID: "client_1"}, time.Time{})
+	if err != nil {
+		t.Fatalf("new refresh token: %v", err)
+	}
+	record.UserID = "u_1"
+	if err = store.SaveRefreshToken(record); err != nil {
+		t.Fatalf("save refresh token: %v", err)
+	}
+	now = now.Add(2*time.Hour + time.Second)
+	if idle := refresh(raw); idle.statusCode != 400 {
+		t.Fatalf("expected idle refresh token to expire, got %d", idle.statusCode)
+	}
+}
+
+func TestTokenExchangeIssuesRefreshTokenOnlyForOfflineAccess(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:                      "client_1",
+		Name:                    "client-1",
+		RedirectURIs:            []string{"https://client.example.com/callback"},
+		Scopes:                  []string{"openid", "offline_access"},
+		GrantTypes:              []string{"authorization_code"},
+		TokenEndpointAuthMethod: "client_secret_post",
+		Status:                  "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	handler := NewTokenHandler(store, newTestTokenService(t, DefaultConfig()))
+	exchange := func(rawCode string, scope []string) TokenResponse {
+		if err := store.SaveAuthCode(AuthCodeRecord{
+			CodeHash:      sha256Hex(rawCode),
+			ClientID:      "client_1",
+			UserID:        "u_1",
+			RedirectURI:   "https://client.example.com/callback",
+			Scope:         scope,
+			CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+			CodeMethod:    "S256",
+			ExpiresAt:     time.Now().UTC().Add(5 * time.Minute),
+		}); err != nil {
+			t.Fatalf("save auth code: %v", err)
+		}
+		ctx := &fakeContext{form: map[string]string{
+			"grant_type":    "authorization_code",
+			"client_id":     "client_1",
+			"client_secret": "secret_1",
+			"code":          rawCode,
+			"redirect_uri":  "https://client.example.com/callback",
+			"code_verifier": "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk",
+		}}
+		handler.Handle(ctx)
+		response, ok := ctx.jsonBody.(TokenResponse)
+		if !ok {
+			t.Fatalf("expected token response, got %s", mustJSON(ctx.jsonBody))
+		}
+		return response
+	}
+
+	if response := exchange("code_online", []string{"openid"}); response.RefreshToken != "" {
+		t.Fatalf("online grant must not receive a refresh token")
+	}
+	if response := exchange("code_no_grant", []string{"openid", "offline_access"}); response.RefreshToken != "" {
+		t.Fatalf("client without refresh_token grant must not receive a refresh token")
+	}
+}
+
+func TestRefreshGrantDownScopesAndReissuesIDToken(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:                      "client_1",
+		Name:                    "client-1",
+		RedirectURIs:            []string{"https://client.example.com/callback"},
+		Scopes:                  []string{"openid", "profile", "offline_access"},
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		TokenEndpointAuthMethod: "client_secret_post",
+		Status:                  "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	authTime := time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Second)
+	rawToken := "refresh_scoped"
+	err = store.SaveRefreshToken(RefreshTokenRecord{
+		TokenHash: sha256Hex(rawToken),
+		FamilyID:  sha256Hex(rawToken),
+		ClientID:  "client_1",
+		UserID:    "u_1",
+		Scope:     []string{"openid", "profile", "offline_access"},
+		ExpiresAt: time.Now().UTC().Add(time.Hour),
+		CreatedAt: time.Now().UTC(),
+		AuthTime:  authTime,
+	})
+	if err != nil {
+		t.Fatalf("save refresh token: %v", err)
+	}
+
+	ks, err := NewKeyService("")
+	if err != nil {
+		t.Fatalf("new key service: %v", err)
+	}
+	ts := NewTokenService(DefaultConfig(), ks)
+	handler := NewTokenHandler(store, ts)
+	refresh := func(token, scope string) *fakeContext {
+		ctx := &fakeContext{form: map[string]string{
+			"grant_type":    "refresh_token",
+			"client_id":     "client_1",
+			"client_secret": "secret_1",
+			"refresh_token": token,
+			"scope":         scope,
+		}}
+		handler.Handle(ctx)
+		return ctx
+	}
+
+	widened := refresh(rawToken, "openid email")
+	if widened.statusCode != 400 || mustOAuthError(widened.jsonBody).Error != "invalid_scope" {
+		t.Fatalf("expected invalid_scope for widening, got %d %s", widened.statusCode, mustJSON(widened.jsonBody))
+	}
+
+	ctx := refresh(rawToken, "openid")
+	if ctx.statusCode != 200 {
+		t.Fatalf("expected 200, got %d %s", ctx.statusCode, mustJSON(ctx.jsonBody))
+	}
+	response := ctx.jsonBody.(TokenResponse)
+	if response.Scope != "openid" {
+		t.Fatalf("expected narrowed scope, got %q", response.Scope)
+	}
+	accessClaims, err := ts.ParseAndValidateAccessToken(response.AccessToken)
+	if err != nil || accessClaims["scope"] != "openid" {
+		t.Fatalf("expected narrowed access token, got %v err=%v", accessClaims["scope"], err)
+	}
+	idClaims := jwt.MapClaims{}
+	if _, err = jwt.ParseWithClaims(response.IDToken, idClaims, func(token *jwt.Token) (interface{}, error) {
+		return ks.PublicKey(), nil
+	}); err != nil {
+		t.Fatalf("parse id token: %v", err)
+	}
+	if int64(idClaims["auth_time"].(float64)) != authTime.Unix() {
+		t.Fatalf("expected original auth_time, got %v", idClaims["auth_time"])
+	}
+	if _, ok := idClaims["nonce"]; ok {
+		t.Fatalf("refreshed id token must not carry a nonce")
+	}
+
+	rotated, err := store.GetRefreshToken(response.RefreshToken, time.Now().UTC())
+	if err != nil || len(rotated.Scope) != 3 {
+		t.Fatalf("rotated refresh token must keep the original scope: %+v err=%v", rotated.Scope, err)
+	}
+
+	ctx = refresh(response.RefreshToken, "profile")
+	if response = ctx.jsonBody.(TokenResponse); response.IDToken != "" {
+		t.Fatalf("id token must only be reissued with openid")
 	}
 }
@@ -1,6 +1,7 @@
 package oidc
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -51,7 +52,7 @@ func TestUserInfoWithBearerToken(t *testing.T) {
 		t.Fatalf("issue token: %v", err)
 	}
 
-	handler := NewUserInfoHandler(ts, func(userID string) (UserProfile, error) {
+	handler := NewUserInfoHandler(NewInMemoryStore(), ts, func(userID string) (UserProfile, error) {
 		return UserProfile{
 			ID:       userID,
 			Username: "user",
@@ -102,7 +103,7 @@ func TestRevokeRefreshToken(t *testing.T) {
 		t.Fatalf("save refresh token: %v", err)
 	}
 
-	handler := NewRevokeHandler(store)
+	handler := NewRevokeHandler(store, newTestTokenService(t, DefaultConfig()))
 	ctx := &fakeContext{form: map[string]string{
 		"token":         rawToken,
 		"client_id":     "client_1",
@@ -117,3 +118,277 @@ func TestRevokeRefreshToken(t *testing.T) {
 		t.Fatalf("token should be revoked")
 	}
 }
+
+func TestAuthorizationServerMetadataMatchesDiscovery(t *testing.T) {
+	config := DefaultConfig()
+	config.Issuer = "https://answer.example.com"
+	ks, err := NewKeyService("")
+	if err != nil {
+		t.Fatalf("new key service: %v", err)
+	}
+	handler := NewMetadataHandler(config, ks)
+	discovery := &fakeContext{}
+	handler.HandleDiscovery(discovery)
+	oauth := &fakeContext{}
+	handler.HandleAuthorizationServerMetadata(oauth)
+
+	if oauth.statusCode != 200 {
+		t.Fatalf("expected 200, got %d", oauth.statusCode)
+	}
+	oidcBody := discovery.jsonBody.(map[string]any)
+	oauthBody := oauth.jsonBody.(map[string]any)
+	for key, value := range oauthBody {
+		if mustJSON(oidcBody[key]) != mustJSON(value) {
+			t.Fatalf("metadata %s drifted: oauth=%v oidc=%v", key, value, oidcBody[key])
+		}
+	}
+	if _, ok := oauthBody["userinfo_endpoint"]; ok {
+		t.Fatalf("oauth metadata should not advertise userinfo")
+	}
+}
+
+func TestWebFingerReturnsIssuer(t *testing.T) {
+	config := DefaultConfig()
+	config.Issuer = "https://answer.example.com"
+	ks, err := NewKeyService("")
+	if err != nil {
+		t.Fatalf("new key service: %v", err)
+	}
+	handler := NewMetadataHandler(config, ks)
+
+	ctx := &fakeContext{query: map[string]string{
+		"resource": "acct:alice@answer.example.com",
+		"rel":      webFingerIssuerRel,
+	}}
+	handler.HandleWebFinger(ctx)
+	if ctx.statusCode != 200 || !strings.Contains(mustJSON(ctx.jsonBody), `"href":"https://answer.example.com"`) {
+		t.Fatalf("unexpected webfinger response: %d %s", ctx.statusCode, mustJSON(ctx.jsonBody))
+	}
+
+	ctx = &fakeContext{query: map[string]string{"resource": "acct:alice@other.example.com"}}
+	handler.HandleWebFinger(ctx)
+	if ctx.statusCode != 404 {
+		t.Fatalf("expected 404 for foreign resource, got %d", ctx.statusCode)
+	}
+}
+
+func TestTokenEndpointHandlesAdvertisedGrantTypes(t *testing.T) {
+	handler := NewTokenHandler(NewInMemoryStore(), newTestTokenService(t, DefaultConfig()))
+	for _, grantType := range supportedGrantTypes {
+		ctx := &fakeContext{form: map[string]string{"grant_type": grantType}}
+		handler.Handle(ctx)
+		if strings.Contains(mustJSON(ctx.jsonBody), "unsupported_grant_type") {
+			t.Fatalf("advertised grant type %s is not handled", grantType)
+		}
+	}
+}
+
+func TestIssuerModes(t *testing.T) {
+	root := DefaultConfig().WithSiteURL("https://answer.example.com/")
+	if issuer := root.IssuerURL(); issuer != "https://answer.example.com" {
+		t.Fatalf("unexpected root issuer: %s", issuer)
+	}
+	if endpoint := root.endpointURL("/token"); endpoint != "https://answer.example.com/answer/api/v1/api/auth/oidc/token" {
+		t.Fatalf("unexpected root token endpoint: %s", endpoint)
+	}
+	automatic := root
+	automatic.IssuerMode = IssuerModeBasePath
+	if issuer := automatic.IssuerURL(); issuer != "https://answer.example.com/answer/api/v1/api/auth/oidc" {
+		t.Fatalf("unexpected automatic issuer: %s", issuer)
+	}
+
+	config := DefaultConfig()
+	config.Issuer = "https://answer.example.com"
+	config.IssuerMode = IssuerModeBasePath
+	ks, err := NewKeyService("")
+	if err != nil {
+		t.Fatalf("new key service: %v", err)
+	}
+	ctx := &fakeContext{}
+	NewMetadataHandler(config, ks).HandleDiscovery(ctx)
+	body := ctx.jsonBody.(map[string]any)
+	if body["issuer"] != "https://answer.example.com/api/auth/oidc" {
+		t.Fatalf("unexpected issuer: %v", body["issuer"])
+	}
+	if body["token_endpoint"] != "https://answer.example.com/api/auth/oidc/token" {
+		t.Fatalf("unexpected token endpoint: %v", body["token_endpoint"])
+	}
+
+	ts := NewTokenService(config, ks)
+	accessToken, _, err := ts.IssueAccessToken(AccessTokenClaims{Subject: "u_1", Audience: "client_1", Scope: []string{"openid"}})
+	if err != nil {
+		t.Fatalf("issue access token: %v", err)
+	}
+	claims, err := ts.ParseAndValidateAccessToken(accessToken)
+	if err != nil {
+		t.Fatalf("parse access token: %v", err)
+	}
+	if claims["iss"] != body["issuer"] {
+		t.Fatalf("token iss %v does not match discovery issuer %v", claims["iss"], body["issuer"])
+	}
+}
+
+func TestJWKSCacheMaxAgeConfig(t *testing.T) {
+	config, err := parseConfig([]byte(`{"issuer":"https://answer.example.com","jwks_cache_max_age_seconds":3600}`), DefaultConfig())
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	ks, err := NewKeyService("")
+	if err != nil {
+		t.Fatalf("new key service: %v", err)
+	}
+	ctx := &fakeContext{}
+	NewMetadataHandler(config, ks).HandleJWKS(ctx)
+	if ctx.setHeaders["Cache-Control"] != "public, max-age=3600" {
+		t.Fatalf("unexpected jwks cache header: %v", ctx.setHeaders)
+	}
+
+	config.JWKSCacheMaxAge = -time.Second
+	ctx = &fakeContext{}
+	NewMetadataHandler(config, ks).HandleJWKS(ctx)
+	if ctx.setHeaders["Cache-Control"] != "public, max-age=300" {
+		t.Fatalf("expected default jwks cache header, got %v", ctx.setHeaders)
+	}
+}
+
+func TestDiscoveryAndJWKSCaching(t *testing.T) {
+	config := DefaultConfig()
+	config.Issuer = "https://answer.example.com"
+	ks, err := NewKeyService("")
+	if err != nil {
+		t.Fatalf("new key service: %v", err)
+	}
+	handler := NewMetadataHandler(config, ks)
+
+	first := &fakeContext{}
+	handler.HandleJWKS(first)
+	etag := first.setHeaders["ETag"]
+	if first.statusCode != 200 || !strings.HasPrefix(etag, `"`) || first.setHeaders["Cache-Control"] != "public, max-age=300" {
+		t.Fatalf("unexpected jwks response: %d headers=%v", first.statusCode, first.setHeaders)
+	}
+
+	again := &fakeContext{}
+	NewMetadataHandler(config, ks).HandleJWKS(again)
+	if again.setHeaders["ETag"] != etag {
+		t.Fatalf("etag should be stable across rebuilds: %s vs %s", again.setHeaders["ETag"], etag)
+	}
+
+	notModified := &fakeContext{headers: map[string]string{"If-None-Match": `"other", ` + etag}}
+	handler.HandleJWKS(notModified)
+	if notModified.statusCode != 304 || notModified.dataBody != nil {
+		t.Fatalf("expected 304 without body, got %d", notModified.statusCode)
+	}
+
+	rotated, err := NewKeyService("")
+	if err != nil {
+		t.Fatalf("new key service: %v", err)
+	}
+	changed := &fakeContext{headers: map[string]string{"If-None-Match": etag}}
+	NewMetadataHandler(config, rotated).HandleJWKS(changed)
+	if changed.statusCode != 200 || changed.setHeaders["ETag"] == etag {
+		t.Fatalf("expected new jwks after key change, got %d", changed.statusCode)
+	}
+
+	discovery := &fakeContext{}
+	handler.HandleDiscovery(discovery)
+	if discovery.setHeaders["Cache-Control"] != "public, max-age=3600" || discovery.setHeaders["ETag"] == "" {
+		t.Fatalf("unexpected discovery headers: %v", discovery.setHeaders)
+	}
+}
+
+func TestRevokeJWTAccessTokenAddsToDenylist(t *testing.T) {
+	store := NewInMemoryStore()
+	for _, id := range []string{"client_1", "client_2"} {
+		if _, _, err := store.CreateClient(OIDCClient{ID: id, Name: id, Status: "active"}, "secret_1"); err != nil {
+			t.Fatalf("create client: %v", err)
+		}
+	}
+	ts := newTestTokenService(t, DefaultConfig())
+	ts.SetAccessTokenDenylist(store)
+	accessToken, _, err := ts.IssueAccessToken(AccessTokenClaims{Audience: "client_1", Subject: "u_1"})
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+	claims, err := ts.ParseAndValidateAccessToken(accessToken)
+	if err != nil {
+		t.Fatalf("validate token: %v", err)
+	}
+	if jti, _ := claims["jti"].(string); jti == "" {
+		t.Fatalf("expected jti claim")
+	}
+
+	handler := NewRevokeHandler(store, ts)
+	ctx := &fakeContext{form: map[string]string{"token": accessToken, "token_type_hint": "access_token", "client_id": "client_2", "client_secret": "secret_1"}}
+	handler.Handle(ctx)
+	if _, err = ts.ParseAndValidateAccessToken(accessToken); err != nil {
+		t.Fatalf("another client must not revoke the token: %v", err)
+	}
+
+	ctx = &fakeContext{form: map[string]string{"token": accessToken, "token_type_hint": "access_token", "client_id": "client_1", "client_secret": "secret_1"}}
+	handler.Handle(ctx)
+	if ctx.statusCode != 200 {
+		t.Fatalf("expected 200, got %d", ctx.statusCode)
+	}
+	if _, err = ts.ParseAndValidateAccessToken(accessToken); err == nil {
+		t.Fatalf("expected revoked access token to be rejected")
+	}
+
+	denied, err := store.IsAccessTokenDenied(claims["jti"].(string), time.Now().UTC().Add(time.Hour))
+	if err != nil || denied {
+		t.Fatalf("denylist entry should lapse after token expiry: denied=%v err=%v", denied, err)
+	}
+}
+
+func TestOAuthOnlyGrantGetsNoIdentityData(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:                      "client_1",
+		Name:                    "client-1",
+		RedirectURIs:            []string{"https://client.example.com/callback"},
+		Scopes:                  []string{"profile"},
+		GrantTypes:              []string{"authorization_code"},
+		TokenEndpointAuthMethod: "client_secret_post",
+		Status:                  "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	err = store.SaveAuthCode(AuthCodeRecord{
+		CodeHash:      sha256Hex("code_oauth"),
+		ClientID:      "client_1",
+		UserID:        "u_1",
+		RedirectURI:   "https://client.example.com/callback",
+		Scope:         []string{"profile"},
+		CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		CodeMethod:    "S256",
+		ExpiresAt:     time.Now().UTC().Add(5 * time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("save auth code: %v", err)
+	}
+	ts := newTestTokenService(t, DefaultConfig())
+	ctx := &fakeContext{form: map[string]string{
+		"grant_type":    "authorization_code",
+		"client_id":     "client_1",
+		"client_secret": "secret_1",
+		"code":          "code_oauth",
+		"redirect_uri":  "https://client.example.com/callback",
+		"code_verifier": "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk",
+	}}
+	NewTokenHandler(store, ts).Handle(ctx)
+	response, ok := ctx.jsonBody.(TokenResponse)
+	if !ok || response.AccessToken == "" {
+		t.Fatalf("expected access token, got %s", mustJSON(ctx.jsonBody))
+	}
+	if response.IDToken != "" {
+		t.Fatalf("pure OAuth grant must not receive an id token")
+	}
+
+	userinfo := &fakeContext{headers: map[string]string{"Authorization": "Bearer " + response.AccessToken}}
+	NewUserInfoHandler(store, ts, func(userID string) (UserProfile, error) {
+		return UserProfile{ID: userID, Email: "user@example.com"}, nil
+	}).Handle(userinfo)
+	if userinfo.statusCode != 403 || mustOAuthError(userinfo.jsonBody).Error != "insufficient_scope" {
+		t.Fatalf("expected insufficient_scope, got %d %s", userinfo.statusCode, mustJSON(userinfo.jsonBody))
+	}
+}
@@ -0,0 +1,150 @@
+package oidc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminResourceRegistry(t *testing.T) {
+	store := NewInMemoryStore()
+	handler := NewAdminResourceHandler(store)
+
+	invalid := &fakeContext{bindBody: []byte(`{"uri":"https://api.example.com/#frag","scopes":["api.read"]}`)}
+	handler.HandleSave(invalid)
+	if invalid.statusCode != 400 {
+		t.Fatalf("expected fragment to be rejected, got %d", invalid.statusCode)
+	}
+
+	saved := &fakeContext{bindBody: []byte(`{"uri":"https://api.example.com","name":"API","scopes":["api.read","api.write"]}`)}
+	handler.HandleSave(saved)
+	if saved.statusCode != 200 {
+		t.Fatalf("expected 200, got %d %s", saved.statusCode, mustJSON(saved.jsonBody))
+	}
+	if resources := store.ListResources(); len(resources) != 1 || len(resources[0].Scopes) != 2 {
+		t.Fatalf("unexpected registry: %+v", resources)
+	}
+
+	deleted := &fakeContext{query: map[string]string{"uri": "https://api.example.com"}}
+	handler.HandleDelete(deleted)
+	if deleted.statusCode != 204 {
+		t.Fatalf("expected 204, got %d", deleted.statusCode)
+	}
+	if _, err := store.GetResource("https://api.example.com"); err != ErrResourceNotFound {
+		t.Fatalf("expected resource to be deleted, got %v", err)
+	}
+}
+
+func TestResourceIndicatorsRestrictAccessTokenAudience(t *testing.T) {
+	store := NewInMemoryStore()
+	_, _, err := store.CreateClient(OIDCClient{
+		ID:                      "client_1",
+		Name:                    "client-1",
+		RedirectURIs:            []string{"https://client.example.com/callback"},
+		Scopes:                  []string{"openid", "offline_access", "api.read", "billing.read"},
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		TokenEndpointAuthMethod: "client_secret_post",
+		Status:                  "active",
+	}, "secret_1")
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	for uri, scopes := range map[string][]string{
+		"https://api.example.com":     {"api.read"},
+		"https://billing.example.com": {"billing.read"},
+	} {
+		if _, err = store.SaveResource(ProtectedResource{URI: uri, Scopes: scopes}); err != nil {
+			t.Fatalf("save resource: %v", err)
+		}
+	}
+	ts := newTestTokenService(t, DefaultConfig())
+	authorize := NewAuthorizeHandler(store, DefaultConfig(), ts, func(_ HTTPContext) (UserProfile, error) {
+		return UserProfile{ID: "u_1"}, nil
+	})
+
+	unknown := &fakeContext{
+		query:  authorizeTestQuery(map[string]string{"scope": "openid api.read", "nonce": "nonce-unknown"}),
+		arrays: map[string][]string{"resource": {"https://unknown.example.com"}},
+	}
+	authorize.Handle(unknown)
+	if query := mustRedirectQuery(t, unknown); query.Get("error") != "invalid_target" {
+		t.Fatalf("expected invalid_target, got %s", unknown.redirect)
+	}
+
+	ctx := &fakeContext{
+		query:  authorizeTestQuery(map[string]string{"scope": "openid offline_access api.read billing.read", "prompt": "consent"}),
+		arrays: map[string][]string{"resource": {"https://api.example.com", "https://billing.example.com"}},
+	}
+	authorize.Handle(ctx)
+	start := strings.Index(ctx.htmlBody, `name="txn" value="`) + len(`name="txn" value="`)
+	txnID := ctx.htmlBody[start : start+strings.Index(ctx.htmlBody[start:], `"`)]
+	approved := &fakeContext{form: map[string]string{"txn": txnID, "decision": "approve"}}
+	authorize.HandleConsent(approved)
+	code := mustRedirectQuery(t, approved).Get("code")
+	if code == "" {
+		t.Fatalf("expected code, got %s", approved.redirect)
+	}
+
+	token := NewTokenHandler(store, ts)
+	exchange := &fakeContext{
+		form: map[string]string{
+			"grant_type":    "authorization_code",
+			"client_id":     "client_1",
+			"client_secret": "secret_1",
+			"code":          code,
+			"redirect_uri":  "https://client.example.com/callback",
+			"code_verifier": "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk",
+		},
+		arrays: map[string][]string{"resource": {"https://api.example.com"}},
+	}
+	token.Handle(exchange)
+	response, ok := exchange.jsonBody.(TokenResponse)
+	if !ok {
+		t.Fatalf("expected token response, got %s", mustJSON(exchange.jsonBody))
+	}
+	claims, err := ts.ParseAndValidateAccessToken(response.AccessToken)
+	if err != nil {
+		t.Fatalf("parse access token: %v", err)
+	}
+	if claims["aud"] != "https://api.example.com" || claims["scope"] != "api.read" || claims["client_id"] != "client_1" {
+		t.Fatalf("unexpected audience-restricted claims: %v", claims)
+	}
+	if response.IDToken == "" {
+		t.Fatalf("openid grant should still receive an id token")
+	}
+
+	refresh := func(resource string) *fakeContext {
+		ctx := &fakeContext{form: map[string]string{
+			"grant_type":    "refresh_token",
+			"client_id":     "client_1",
+			"client_secret": "secret_1",
+			"refresh_token": response.RefreshToken,
+			"resource":      resource,
+		}}
+		token.Handle(ctx)
+		return ctx
+	}
+	if foreign := refresh("https://unknown.example.com"); mustOAuthError(foreign.jsonBody).Error != "invalid_target" {
+		t.Fatalf("expected invalid_target for ungranted resource, got %s", mustJSON(foreign.jsonBody))
+	}
+	refreshed := refresh("https://billing.example.com")
+	billing, ok := refreshed.jsonBody.(TokenResponse)
+	if !ok {
+		t.Fatalf("expected token response, got %s", mustJSON(refreshed.jsonBody))
+	}
+	claims, err = ts.ParseAndValidateAccessToken(billing.AccessToken)
+	if err != nil || claims["aud"] != "https://billing.example.com" || claims["scope"] != "billing.read" {
+		t.Fatalf("expected billing audience, got %v err=%v", claims, err)
+	}
+	rotated, err := store.GetRefreshToken(billing.RefreshToken, time.Now().UTC())
+	if err != nil || len(rotated.Resources) != 2 {
+		t.Fatalf("rotated refresh token must keep granted resources: %+v err=%v", rotated.Resources, err)
+	}
+
+	introspect := &fakeContext{form: map[string]string{"token": billing.AccessToken, "client_id": "client_1", "client_secret": "secret_1"}}
+	NewIntrospectHandler(store, ts).Handle(introspect)
+	body := introspect.jsonBody.(map[string]any)
+	if body["active"] != true || body["client_id"] != "client_1" || body["aud"] != "https://billing.example.com" {
+		t.Fatalf("unexpected introspection: %v", body)
+	}
+}
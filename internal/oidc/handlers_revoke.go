@@ -8,14 +8,16 @@ import (
 )
 
 type RevokeHandler struct {
-	store Store
-	nowFn func() time.Time
+	store        Store
+	tokenService *TokenService
+	nowFn        func() time.Time
 }
 
-func NewRevokeHandler(store Store) *RevokeHandler {
+func NewRevokeHandler(store Store, tokenService *TokenService) *RevokeHandler {
 	return &RevokeHandler{
-		store: store,
-		nowFn: func() time.Time { return time.Now().UTC() },
+		store:        store,
+		tokenService: tokenService,
+		nowFn:        func() time.Time { return time.Now().UTC() },
 	}
 }
 
@@ -35,22 +37,74 @@ func (h *RevokeHandler) Handle(ctx HTTPContext) {
 	}
 
 	now := h.nowFn()
+	attempts := []func(OIDCClient, string, time.Time) (bool, error){h.revokeRefreshToken, h.revokeAccessToken}
+	if strings.TrimSpace(ctx.PostForm("token_type_hint")) == "access_token" {
+		attempts[0], attempts[1] = attempts[1], attempts[0]
+	}
+	for _, attempt := range attempts {
+		found, err := attempt(client, token, now)
+		if err != nil {
+			writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to revoke token", "revoke")
+			return
+		}
+		if found {
+			break
+		}
+	}
+	ctx.Status(http.StatusOK)
+}
+
+func (h *RevokeHandler) revokeRefreshToken(client OIDCClient, token string, now time.Time) (bool, error) {
 	record, err := h.store.GetRefreshToken(token, now)
 	if err != nil {
-		if errors.Is(err, ErrRefreshTokenNotFound) || errors.Is(err, ErrRefreshTokenExpired) || errors.Is(err, ErrRefreshTokenRevoked) {
-			ctx.Status(http.StatusOK)
-			return
+		if errors.Is(err, ErrRefreshTokenNotFound) {
+			return false, nil
 		}
-		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to revoke token", "revoke")
-		return
+		if errors.Is(err, ErrRefreshTokenExpired) || errors.Is(err, ErrRefreshTokenRevoked) {
+			return true, nil
+		}
+		return false, err
 	}
 	if !constantTimeEquals(record.ClientID, client.ID) {
-		ctx.Status(http.StatusOK)
-		return
+		return true, nil
 	}
-	if err = h.store.RevokeRefreshToken(token, now); err != nil {
-		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to revoke token", "revoke")
-		return
+	return true, h.store.RevokeRefreshToken(token, now)
+}
+
+func (h *RevokeHandler) revokeAccessToken(client OIDCClient, token string, now time.Time) (bool, error) {
+	if isJWTAccessToken(token) {
+		claims, err := h.tokenService.ParseAndValidateAccessToken(token)
+		if err != nil {
+			return false, nil
+		}
+		owner := tokenClientID(claims)
+		jti, _ := claims["jti"].(string)
+		if !constantTimeEquals(owner, client.ID) || jti == "" {
+			return true, nil
+		}
+		exp, ok := claimTime(claims["exp"])
+		if !ok {
+			return true, nil
+		}
+		return true, h.store.DenyAccessToken(DeniedAccessTokenRecord{
+			JTI:       jti,
+			ClientID:  client.ID,
+			ExpiresAt: exp,
+			RevokedAt: now,
+		})
 	}
-	ctx.Status(http.StatusOK)
+	record, err := h.store.GetAccessToken(token, now)
+	if err != nil {
+		if errors.Is(err, ErrAccessTokenNotFound) {
+			return false, nil
+		}
+		if errors.Is(err, ErrAccessTokenExpired) || errors.Is(err, ErrAccessTokenRevoked) {
+			return true, nil
+		}
+		return false, err
+	}
+	if !constantTimeEquals(record.ClientID, client.ID) {
+		return true, nil
+	}
+	return true, h.store.RevokeAccessToken(token, now)
 }
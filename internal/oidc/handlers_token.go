@@ -23,6 +23,10 @@ func NewTokenHandler(store Store, tokenService *TokenService) *TokenHandler {
 
 func (h *TokenHandler) Handle(ctx HTTPContext) {
 	grantType := strings.TrimSpace(ctx.PostForm("grant_type"))
+	if !containsValue(supportedGrantTypes, grantType) {
+		writeOAuthError(ctx, http.StatusBadRequest, "unsupported_grant_type", "grant_type is not supported", "token")
+		return
+	}
 	if grantType == "authorization_code" {
 		h.handleAuthorizationCodeGrant(ctx)
 		return
@@ -31,6 +35,10 @@ func (h *TokenHandler) Handle(ctx HTTPContext) {
 		h.handleRefreshGrant(ctx)
 		return
 	}
+	if grantType == cibaGrantType {
+		h.handleBackchannelGrant(ctx)
+		return
+	}
 	writeOAuthError(ctx, http.StatusBadRequest, "unsupported_grant_type", "grant_type is not supported", "token")
 }
 
@@ -59,6 +67,10 @@ func (h *TokenHandler) handleAuthorizationCodeGrant(ctx HTTPContext) {
 		h.mapCodeError(ctx, err)
 		return
 	}
+	if codeRecord.Issuer != "" && !constantTimeEquals(codeRecord.Issuer, h.tokenService.Issuer()) {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_grant", "authorization code was issued by a different issuer", "token")
+		return
+	}
 	if !constantTimeEquals(codeRecord.ClientID, client.ID) || !constantTimeEquals(codeRecord.RedirectURI, redirectURI) {
 		writeOAuthError(ctx, http.StatusBadRequest, "invalid_grant", "authorization code does not match client or redirect_uri", "token")
 		return
@@ -67,7 +79,25 @@ func (h *TokenHandler) handleAuthorizationCodeGrant(ctx HTTPContext) {
 		writeOAuthError(ctx, http.StatusBadRequest, "invalid_grant", "code_verifier is invalid", "token")
 		return
 	}
-	response, err := h.issueTokenResponse(client, codeRecord.UserID, codeRecord.Nonce, codeRecord.Scope)
+	target, ok := h.resourceTarget(ctx, codeRecord.Resources, codeRecord.Scope)
+	if !ok {
+		return
+	}
+	if target.AuthorizationDetails, ok = h.detailsTarget(ctx, codeRecord.AuthorizationDetails); !ok {
+		return
+	}
+	response, err := h.issueTokenResponse(client, tokenGrant{
+		UserID:               codeRecord.UserID,
+		Nonce:                codeRecord.Nonce,
+		Scope:                codeRecord.Scope,
+		AuthTime:             codeRecord.AuthTime,
+		ACR:                  codeRecord.ACR,
+		AMR:                  codeRecord.AMR,
+		Roles:                codeRecord.Roles,
+		Groups:               codeRecord.Groups,
+		Resources:            codeRecord.Resources,
+		AuthorizationDetails: codeRecord.AuthorizationDetails,
+	}, target)
 	if err != nil {
 		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to issue tokens", "token")
 		return
@@ -94,6 +124,10 @@ func (h *TokenHandler) handleRefreshGrant(ctx HTTPContext) {
 	}
 	now := h.nowFn()
 	record, err := h.store.GetRefreshToken(refreshToken, now)
+	if errors.Is(err, ErrRefreshTokenRevoked) && record.ReplacedBy != "" && constantTimeEquals(record.ClientID, client.ID) {
+		h.handleRotatedRefresh(ctx, client, record, now)
+		return
+	}
 	if err != nil {
 		writeOAuthError(ctx, http.StatusBadRequest, "invalid_grant", "refresh token is invalid", "token")
 		return
@@ -102,14 +136,45 @@ func (h *TokenHandler) handleRefreshGrant(ctx HTTPContext) {
 		writeOAuthError(ctx, http.StatusBadRequest, "invalid_grant", "refresh token does not belong to client", "token")
 		return
 	}
-	response, newRecord, rawRefresh, err := h.issueRefreshedResponse(client, record.UserID, record.Scope)
+	if record.FamilyID == "" {
+		record.FamilyID = record.TokenHash
+	}
+	scope, ok := refreshScope(ctx, record)
+	if !ok {
+		return
+	}
+	target, ok := h.resourceTarget(ctx, record.Resources, scope)
+	if !ok {
+		return
+	}
+	if target.AuthorizationDetails, ok = h.detailsTarget(ctx, record.AuthorizationDetails); !ok {
+		return
+	}
+	response, newRecord, rawRefresh, err := h.issueRefreshedResponse(client, tokenGrant{
+		UserID:               record.UserID,
+		Scope:                record.Scope,
+		AuthTime:             record.AuthTime,
+		ACR:                  record.ACR,
+		AMR:                  record.AMR,
+		Roles:                record.Roles,
+		Groups:               record.Groups,
+		MaxExpiresAt:         record.MaxExpiresAt,
+		Resources:            record.Resources,
+		AuthorizationDetails: record.AuthorizationDetails,
+	}, scope, target)
 	if err != nil {
 		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to issue refreshed tokens", "token")
 		return
 	}
+	newRecord.FamilyID = record.FamilyID
+	newRecord.RotatedFrom = record.TokenHash
 	if err = h.store.RotateRefreshToken(refreshToken, newRecord, now); err != nil {
 		if errors.Is(err, ErrRefreshTokenReplay) {
-			writeOAuthError(ctx, http.StatusBadRequest, "invalid_grant", "refresh token replay detected", "token")
+			if rotated, getErr := h.store.GetRefreshToken(refreshToken, now); errors.Is(getErr, ErrRefreshTokenRevoked) && rotated.ReplacedBy != "" {
+				h.handleRotatedRefresh(ctx, client, rotated, now)
+				return
+			}
+			h.handleRefreshReplay(ctx, record, now)
 			return
 		}
 		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to rotate refresh token", "token")
@@ -119,6 +184,92 @@ func (h *TokenHandler) handleRefreshGrant(ctx HTTPContext) {
 	ctx.JSON(http.StatusOK, response)
 }
 
+func (h *TokenHandler) handleRotatedRefresh(ctx HTTPContext, client OIDCClient, record RefreshTokenRecord, now time.Time) {
+	grace := h.tokenService.RefreshReuseGrace()
+	if grace <= 0 || record.RevokedAt == nil || now.Sub(*record.RevokedAt) > grace {
+		h.handleRefreshReplay(ctx, record, now)
+		return
+	}
+	if _, err := h.store.GetRefreshTokenByHash(record.ReplacedBy, now); err != nil {
+		h.handleRefreshReplay(ctx, record, now)
+		return
+	}
+	scope, ok := refreshScope(ctx, record)
+	if !ok {
+		return
+	}
+	target, ok := h.resourceTarget(ctx, record.Resources, scope)
+	if !ok {
+		return
+	}
+	if target.AuthorizationDetails, ok = h.detailsTarget(ctx, record.AuthorizationDetails); !ok {
+		return
+	}
+	response, sibling, rawRefresh, err := h.issueRefreshedResponse(client, tokenGrant{
+		UserID:               record.UserID,
+		Scope:                record.Scope,
+		AuthTime:             record.AuthTime,
+		ACR:                  record.ACR,
+		AMR:                  record.AMR,
+		Roles:                record.Roles,
+		Groups:               record.Groups,
+		MaxExpiresAt:         record.MaxExpiresAt,
+		Resources:            record.Resources,
+		AuthorizationDetails: record.AuthorizationDetails,
+	}, scope, target)
+	if err != nil {
+		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to issue refreshed tokens", "token")
+		return
+	}
+	sibling.FamilyID = record.FamilyID
+	if sibling.FamilyID == "" {
+		sibling.FamilyID = record.TokenHash
+	}
+	sibling.RotatedFrom = record.TokenHash
+	if err = h.store.SaveRefreshToken(sibling); err != nil {
+		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to save refresh token", "token")
+		return
+	}
+	response.RefreshToken = rawRefresh
+	ctx.JSON(http.StatusOK, response)
+}
+
+func refreshScope(ctx HTTPContext, record RefreshTokenRecord) ([]string, bool) {
+	requested := normalizeScopes(splitScope(ctx.PostForm("scope")))
+	if len(requested) == 0 {
+		return record.Scope, true
+	}
+	if !scopeIsSubset(requested, record.Scope) {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_scope", "requested scope exceeds the original grant", "token")
+		return nil, false
+	}
+	return requested, true
+}
+
+func (h *TokenHandler) handleRefreshReplay(ctx HTTPContext, record RefreshTokenRecord, now time.Time) {
+	familyID := record.FamilyID
+	if familyID == "" {
+		familyID = record.TokenHash
+	}
+	if err := h.store.RevokeRefreshTokenFamily(familyID, now); err != nil {
+		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to revoke refresh token family", "token")
+		return
+	}
+	eventID, err := randomURLSafe(16)
+	if err == nil {
+		_ = h.store.RecordSecurityEvent(SecurityEvent{
+			ID:        eventID,
+			Type:      "refresh_token_replay",
+			ClientID:  record.ClientID,
+			UserID:    record.UserID,
+			FamilyID:  familyID,
+			Detail:    "rotated refresh token was presented again; token family revoked",
+			CreatedAt: now,
+		})
+	}
+	writeOAuthError(ctx, http.StatusBadRequest, "invalid_grant", "refresh token replay detected", "token")
+}
+
 func (h *TokenHandler) mapCodeError(ctx HTTPContext, err error) {
 	if errors.Is(err, ErrAuthCodeNotFound) || errors.Is(err, ErrAuthCodeExpired) || errors.Is(err, ErrAuthCodeConsumed) {
 		writeOAuthError(ctx, http.StatusBadRequest, "invalid_grant", "authorization code is invalid", "token")
@@ -127,72 +278,200 @@ func (h *TokenHandler) mapCodeError(ctx HTTPContext, err error) {
 	writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "failed to consume authorization code", "token")
 }
 
-func (h *TokenHandler) issueTokenResponse(client OIDCClient, userID, nonce string, scopes []string) (TokenResponse, error) {
-	accessToken, expiresIn, err := h.tokenService.IssueAccessToken(AccessTokenClaims{
-		Audience: client.ID,
-		Subject:  userID,
-		Scope:    scopes,
-	})
+type tokenGrant struct {
+	UserID               string
+	Nonce                string
+	Scope                []string
+	AuthTime             time.Time
+	ACR                  string
+	AMR                  []string
+	Roles                []string
+	Groups               []string
+	MaxExpiresAt         time.Time
+	Resources            []string
+	AuthorizationDetails []AuthorizationDetail
+}
+
+type accessTarget struct {
+	Scope                []string
+	Audience             []string
+	AuthorizationDetails []AuthorizationDetail
+}
+
+func (h *TokenHandler) detailsTarget(ctx HTTPContext, granted []AuthorizationDetail) ([]AuthorizationDetail, bool) {
+	requested, err := parseAuthorizationDetails(ctx.PostForm("authorization_details"))
 	if err != nil {
-		return TokenResponse{}, err
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_authorization_details", err.Error(), "token")
+		return nil, false
+	}
+	if len(requested) == 0 {
+		return granted, true
+	}
+	if !authorizationDetailsSubset(requested, granted) {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_authorization_details", "authorization_details were not part of the grant", "token")
+		return nil, false
+	}
+	return requested, true
+}
+
+func (h *TokenHandler) resourceTarget(ctx HTTPContext, granted, scope []string) (accessTarget, bool) {
+	audience := granted
+	if requested := normalizeScopes(ctx.PostFormArray("resource")); len(requested) > 0 {
+		for _, uri := range requested {
+			if len(granted) > 0 && !containsValue(granted, uri) {
+				writeOAuthError(ctx, http.StatusBadRequest, "invalid_target", "resource was not part of the grant", "token")
+				return accessTarget{}, false
+			}
+		}
+		audience = requested
+	}
+	if len(audience) == 0 {
+		return accessTarget{Scope: scope}, true
+	}
+	resources, err := resolveResources(h.store, audience)
+	if err != nil {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_target", err.Error(), "token")
+		return accessTarget{}, false
+	}
+	accessScope := resourceScope(scope, resources)
+	if len(accessScope) == 0 {
+		writeOAuthError(ctx, http.StatusBadRequest, "invalid_scope", "no granted scope is accepted by the resource", "token")
+		return accessTarget{}, false
+	}
+	return accessTarget{Scope: accessScope, Audience: audience}, true
+}
+
+func refreshExpiresIn(record RefreshTokenRecord) int64 {
+	return int64(record.ExpiresAt.Sub(record.CreatedAt) / time.Second)
+}
+
+func (h *TokenHandler) issueAccessToken(client OIDCClient, grant tokenGrant, target accessTarget) (string, int64, error) {
+	if client.AccessTokenFormat != "opaque" {
+		return h.tokenService.IssueAccessToken(AccessTokenClaims{
+			Audience:             client.ID,
+			ClientID:             client.ID,
+			Resources:            target.Audience,
+			Subject:              grant.UserID,
+			Scope:                target.Scope,
+			AuthTime:             grant.AuthTime,
+			Roles:                grant.Roles,
+			Groups:               grant.Groups,
+			AuthorizationDetails: target.AuthorizationDetails,
+			Lifetime:             time.Duration(client.AccessTokenTTLSeconds) * time.Second,
+		})
 	}
-	idToken, _, err := h.tokenService.IssueIDToken(IDTokenClaims{
-		Audience: client.ID,
-		Subject:  userID,
-		Nonce:    nonce,
-	})
+	raw, hash, expiresAt, err := h.tokenService.NewOpaqueAccessToken(time.Duration(client.AccessTokenTTLSeconds) * time.Second)
+	if err != nil {
+		return "", 0, err
+	}
+	now := h.nowFn()
+	if err = h.store.SaveAccessToken(AccessTokenRecord{
+		TokenHash:            hash,
+		ClientID:             client.ID,
+		UserID:               grant.UserID,
+		Scope:                target.Scope,
+		Resources:            target.Audience,
+		AuthorizationDetails: target.AuthorizationDetails,
+		ExpiresAt:            expiresAt,
+		CreatedAt:            now,
+	}); err != nil {
+		return "", 0, err
+	}
+	return raw, int64(expiresAt.Sub(now).Seconds()), nil
+}
+
+func (h *TokenHandler) issueTokenResponse(client OIDCClient, grant tokenGrant, target accessTarget) (TokenResponse, error) {
+	accessToken, expiresIn, err := h.issueAccessToken(client, grant, target)
 	if err != nil {
 		return TokenResponse{}, err
 	}
-	rawRefresh, refreshHash, refreshExpiresAt, err := h.tokenService.NewRefreshToken()
+	idToken := ""
+	if containsValue(grant.Scope, "openid") {
+		idToken, _, err = h.tokenService.IssueIDToken(IDTokenClaims{
+			Audience: client.ID,
+			Subject:  grant.UserID,
+			Nonce:    grant.Nonce,
+			AuthTime: grant.AuthTime,
+			ACR:      grant.ACR,
+			AMR:      grant.AMR,
+			Lifetime: time.Duration(client.IDTokenTTLSeconds) * time.Second,
+		})
+		if err != nil {
+			return TokenResponse{}, err
+		}
+	}
+	response := TokenResponse{
+		AccessToken:          accessToken,
+		TokenType:            "Bearer",
+		ExpiresIn:            expiresIn,
+		IDToken:              idToken,
+		Scope:                joinScope(target.Scope),
+		AuthorizationDetails: target.AuthorizationDetails,
+	}
+	if !ClientAllowsGrantType(client, "refresh_token") || !containsValue(grant.Scope, offlineAccessScope) {
+		return response, nil
+	}
+	rawRefresh, refreshRecord, err := h.tokenService.NewRefreshToken(client, time.Time{})
 	if err != nil {
 		return TokenResponse{}, err
 	}
-	if err = h.store.SaveRefreshToken(RefreshTokenRecord{
-		TokenHash: refreshHash,
-		ClientID:  client.ID,
-		UserID:    userID,
-		Scope:     scopes,
-		ExpiresAt: refreshExpiresAt,
-		CreatedAt: h.nowFn(),
-	}); err != nil {
+	refreshRecord.FamilyID = refreshRecord.TokenHash
+	refreshRecord.UserID = grant.UserID
+	refreshRecord.Scope = grant.Scope
+	refreshRecord.AuthTime = grant.AuthTime
+	refreshRecord.ACR = grant.ACR
+	refreshRecord.AMR = grant.AMR
+	refreshRecord.Roles = grant.Roles
+	refreshRecord.Groups = grant.Groups
+	refreshRecord.Resources = grant.Resources
+	refreshRecord.AuthorizationDetails = grant.AuthorizationDetails
+	if err = h.store.SaveRefreshToken(refreshRecord); err != nil {
 		return TokenResponse{}, err
 	}
-	return TokenResponse{
-		AccessToken:  accessToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    expiresIn,
-		RefreshToken: rawRefresh,
-		IDToken:      idToken,
-		Scope:        joinScope(scopes),
-	}, nil
-}
-
-func (h *TokenHandler) issueRefreshedResponse(client OIDCClient, userID string, scopes []string) (TokenResponse, RefreshTokenRecord, string, error) {
-	accessToken, expiresIn, err := h.tokenService.IssueAccessToken(AccessTokenClaims{
-		Audience: client.ID,
-		Subject:  userID,
-		Scope:    scopes,
-	})
+	response.RefreshToken = rawRefresh
+	response.RefreshExpiresIn = refreshExpiresIn(refreshRecord)
+	return response, nil
+}
+
+func (h *TokenHandler) issueRefreshedResponse(client OIDCClient, grant tokenGrant, scope []string, target accessTarget) (TokenResponse, RefreshTokenRecord, string, error) {
+	accessToken, expiresIn, err := h.issueAccessToken(client, grant, target)
 	if err != nil {
 		return TokenResponse{}, RefreshTokenRecord{}, "", err
 	}
-	rawRefresh, refreshHash, refreshExpiresAt, err := h.tokenService.NewRefreshToken()
+	idToken := ""
+	if containsValue(scope, "openid") {
+		idToken, _, err = h.tokenService.IssueIDToken(IDTokenClaims{
+			Audience: client.ID,
+			Subject:  grant.UserID,
+			AuthTime: grant.AuthTime,
+			ACR:      grant.ACR,
+			AMR:      grant.AMR,
+			Lifetime: time.Duration(client.IDTokenTTLSeconds) * time.Second,
+		})
+		if err != nil {
+			return TokenResponse{}, RefreshTokenRecord{}, "", err
+		}
+	}
+	rawRefresh, newRecord, err := h.tokenService.NewRefreshToken(client, grant.MaxExpiresAt)
 	if err != nil {
 		return TokenResponse{}, RefreshTokenRecord{}, "", err
 	}
-	newRecord := RefreshTokenRecord{
-		TokenHash: refreshHash,
-		ClientID:  client.ID,
-		UserID:    userID,
-		Scope:     scopes,
-		ExpiresAt: refreshExpiresAt,
-		CreatedAt: h.nowFn(),
-	}
+	newRecord.UserID = grant.UserID
+	newRecord.Scope = grant.Scope
+	newRecord.AuthTime = grant.AuthTime
+	newRecord.ACR = grant.ACR
+	newRecord.AMR = grant.AMR
+	newRecord.Roles = grant.Roles
+	newRecord.Groups = grant.Groups
+	newRecord.Resources = grant.Resources
+	newRecord.AuthorizationDetails = grant.AuthorizationDetails
 	return TokenResponse{
-		AccessToken: accessToken,
-		TokenType:   "Bearer",
-		ExpiresIn:   expiresIn,
-		Scope:       joinScope(scopes),
+		AccessToken:          accessToken,
+		TokenType:            "Bearer",
+		ExpiresIn:            expiresIn,
+		RefreshExpiresIn:     refreshExpiresIn(newRecord),
+		IDToken:              idToken,
+		Scope:                joinScope(target.Scope),
+		AuthorizationDetails: target.AuthorizationDetails,
 	}, newRecord, rawRefresh, nil
 }
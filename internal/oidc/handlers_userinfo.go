@@ -3,19 +3,24 @@ package oidc
 import (
 	"net/http"
 	"strings"
+	"time"
 )
 
 type UserInfoResolver func(userID string) (UserProfile, error)
 
 type UserInfoHandler struct {
+	store        Store
 	tokenService *TokenService
 	resolveUser  UserInfoResolver
+	nowFn        func() time.Time
 }
 
-func NewUserInfoHandler(tokenService *TokenService, resolveUser UserInfoResolver) *UserInfoHandler {
+func NewUserInfoHandler(store Store, tokenService *TokenService, resolveUser UserInfoResolver) *UserInfoHandler {
 	return &UserInfoHandler{
+		store:        store,
 		tokenService: tokenService,
 		resolveUser:  resolveUser,
+		nowFn:        func() time.Time { return time.Now().UTC() },
 	}
 }
 
@@ -26,11 +31,16 @@ func (h *UserInfoHandler) Handle(ctx HTTPContext) {
 		return
 	}
 	rawToken := strings.TrimSpace(rawAuthorization[len("Bearer "):])
-	claims, err := h.tokenService.ParseAndValidateAccessToken(rawToken)
+	claims, err := validateAccessToken(h.store, h.tokenService, rawToken, h.nowFn())
 	if err != nil {
 		unauthorized(ctx, "userinfo")
 		return
 	}
+	scope, _ := claims["scope"].(string)
+	if !containsValue(splitScope(scope), "openid") {
+		writeOAuthError(ctx, http.StatusForbidden, "insufficient_scope", "access token does not carry the openid scope", "userinfo")
+		return
+	}
 	userID, _ := claims["sub"].(string)
 	if userID == "" {
 		unauthorized(ctx, "userinfo")
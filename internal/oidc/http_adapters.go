@@ -14,18 +14,38 @@ func (g *GinContext) Query(key string) string {
 	return g.ctx.Query(key)
 }
 
+func (g *GinContext) QueryArray(key string) []string {
+	return g.ctx.QueryArray(key)
+}
+
 func (g *GinContext) PostForm(key string) string {
 	return g.ctx.PostForm(key)
 }
 
+func (g *GinContext) PostFormArray(key string) []string {
+	return g.ctx.PostFormArray(key)
+}
+
 func (g *GinContext) Header(key string) string {
 	return g.ctx.GetHeader(key)
 }
 
+func (g *GinContext) SetHeader(key, value string) {
+	g.ctx.Header(key, value)
+}
+
 func (g *GinContext) JSON(status int, value any) {
 	g.ctx.JSON(status, value)
 }
 
+func (g *GinContext) Data(status int, contentType string, body []byte) {
+	g.ctx.Data(status, contentType, body)
+}
+
+func (g *GinContext) HTML(status int, body string) {
+	g.ctx.Data(status, "text/html; charset=utf-8", []byte(body))
+}
+
 func (g *GinContext) Redirect(status int, location string) {
 	g.ctx.Redirect(status, location)
 }
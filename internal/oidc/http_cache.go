@@ -0,0 +1,56 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const metadataCacheMaxAge = time.Hour
+
+type cachedDocument struct {
+	body         []byte
+	etag         string
+	cacheControl string
+}
+
+func newCachedDocument(value any, maxAge time.Duration) cachedDocument {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return cachedDocument{}
+	}
+	sum := sha256.Sum256(body)
+	return cachedDocument{
+		body:         body,
+		etag:         `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`,
+		cacheControl: fmt.Sprintf("public, max-age=%d", int64(maxAge/time.Second)),
+	}
+}
+
+func (d cachedDocument) serve(ctx HTTPContext, traceID string) {
+	if d.body == nil {
+		writeOAuthError(ctx, http.StatusInternalServerError, "server_error", "document is unavailable", traceID)
+		return
+	}
+	ctx.SetHeader("ETag", d.etag)
+	ctx.SetHeader("Cache-Control", d.cacheControl)
+	if etagMatches(ctx.Header("If-None-Match"), d.etag) {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+	ctx.Data(http.StatusOK, "application/json; charset=utf-8", d.body)
+}
+
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -10,71 +10,233 @@ type PluginInfo struct {
 }
 
 type OIDCClient struct {
-	ID                      string    `json:"id"`
-	Name                    string    `json:"name"`
-	SecretHash              string    `json:"-"`
-	RedirectURIs            []string  `json:"redirect_uris"`
-	Scopes                  []string  `json:"scopes"`
-	GrantTypes              []string  `json:"grant_types"`
-	TokenEndpointAuthMethod string    `json:"token_endpoint_auth_method"`
-	FirstParty              bool      `json:"first_party"`
-	Status                  string    `json:"status"`
-	CreatedAt               time.Time `json:"created_at"`
-	UpdatedAt               time.Time `json:"updated_at"`
+	ID                             string    `json:"id"`
+	Name                           string    `json:"name"`
+	SecretHash                     string    `json:"-"`
+	RedirectURIs                   []string  `json:"redirect_uris"`
+	RedirectURIPatterns            []string  `json:"redirect_uri_patterns,omitempty"`
+	AllowRedirectPatterns          bool      `json:"allow_redirect_patterns"`
+	Scopes                         []string  `json:"scopes"`
+	GrantTypes                     []string  `json:"grant_types"`
+	TokenEndpointAuthMethod        string    `json:"token_endpoint_auth_method"`
+	DefaultResponseMode            string    `json:"default_response_mode,omitempty"`
+	AuthorizationSignedResponseAlg string    `json:"authorization_signed_response_alg,omitempty"`
+	AccessTokenFormat              string    `json:"access_token_format,omitempty"`
+	AccessTokenTTLSeconds          int64     `json:"access_token_ttl_seconds,omitempty"`
+	IDTokenTTLSeconds              int64     `json:"id_token_ttl_seconds,omitempty"`
+	AuthorizationCodeTTLSeconds    int64     `json:"authorization_code_ttl_seconds,omitempty"`
+	RefreshTokenTTLSeconds         int64     `json:"refresh_token_ttl_seconds,omitempty"`
+	RefreshTokenMaxLifetimeSeconds int64     `json:"refresh_token_max_lifetime_seconds,omitempty"`
+	FirstParty                     bool      `json:"first_party"`
+	RequireNonce                   bool      `json:"require_nonce"`
+	Status                         string    `json:"status"`
+	CreatedAt                      time.Time `json:"created_at"`
+	UpdatedAt                      time.Time `json:"updated_at"`
 }
 
 type UserProfile struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Name     string `json:"name"`
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	Name        string    `json:"name"`
+	SessionID   string    `json:"-"`
+	AuthTime    time.Time `json:"-"`
+	AuthMethods []string  `json:"-"`
+	Roles       []string  `json:"-"`
+	Groups      []string  `json:"-"`
+}
+
+type AuthorizeRequest struct {
+	ResponseType         string
+	ClientID             string
+	RedirectURI          string
+	Scope                []string
+	State                string
+	Nonce                string
+	CodeChallenge        string
+	CodeChallengeMethod  string
+	Prompt               []string
+	MaxAge               *int64
+	LoginHint            string
+	IDTokenHint          string
+	ACRValues            []string
+	ResponseMode         string
+	Resources            []string
+	AuthorizationDetails []AuthorizationDetail
+}
+
+type AuthorizeTransaction struct {
+	IDHash           string
+	Request          AuthorizeRequest
+	UserID           string
+	LoginRequestedAt time.Time
+	ConsentGranted   bool
+	ExpiresAt        time.Time
+	CreatedAt        time.Time
+}
+
+type LoginSessionRecord struct {
+	SessionHash string
+	UserID      string
+	AuthTime    time.Time
+	AuthMethods []string
 }
 
 type AuthCodeRecord struct {
-	CodeHash       string
-	ClientID       string
-	UserID         string
-	RedirectURI    string
-	Scope          []string
-	CodeChallenge  string
-	CodeMethod     string
-	Nonce          string
-	ExpiresAt      time.Time
-	ConsumedAt     *time.Time
-	CreatedAt      time.Time
-	OriginalState  string
-	SessionBinding string
+	CodeHash             string
+	ClientID             string
+	UserID               string
+	RedirectURI          string
+	Scope                []string
+	CodeChallenge        string
+	CodeMethod           string
+	Nonce                string
+	ExpiresAt            time.Time
+	ConsumedAt           *time.Time
+	CreatedAt            time.Time
+	OriginalState        string
+	SessionBinding       string
+	Issuer               string
+	AuthTime             time.Time
+	ACR                  string
+	AMR                  []string
+	Roles                []string
+	Groups               []string
+	Resources            []string
+	AuthorizationDetails []AuthorizationDetail
 }
 
 type RefreshTokenRecord struct {
-	TokenHash   string
-	ClientID    string
-	UserID      string
-	Scope       []string
-	ExpiresAt   time.Time
-	RevokedAt   *time.Time
-	CreatedAt   time.Time
-	RotatedFrom string
+	TokenHash            string
+	ClientID             string
+	UserID               string
+	Scope                []string
+	ExpiresAt            time.Time
+	RevokedAt            *time.Time
+	CreatedAt            time.Time
+	FamilyID             string
+	MaxExpiresAt         time.Time
+	Resources            []string
+	RotatedFrom          string
+	ReplacedBy           string
+	AuthTime             time.Time
+	ACR                  string
+	AMR                  []string
+	Roles                []string
+	Groups               []string
+	AuthorizationDetails []AuthorizationDetail
+}
+
+type AccessTokenRecord struct {
+	TokenHash            string
+	ClientID             string
+	UserID               string
+	Scope                []string
+	Resources            []string
+	AuthorizationDetails []AuthorizationDetail
+	ExpiresAt            time.Time
+	RevokedAt            *time.Time
+	CreatedAt            time.Time
+}
+
+type DeniedAccessTokenRecord struct {
+	JTI       string
+	ClientID  string
+	ExpiresAt time.Time
+	RevokedAt time.Time
+}
+
+type ProtectedResource struct {
+	URI       string    `json:"uri"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ClientID  string    `json:"client_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type BackchannelAuthRequest struct {
+	IDHash          string
+	ClientID        string
+	UserID          string
+	Scope           []string
+	BindingMessage  string
+	Status          string
+	Interval        int64
+	AuthTime        time.Time
+	AMR             []string
+	Roles           []string
+	Groups          []string
+	LastPolledAt    time.Time
+	ExpiresAt       time.Time
+	CreatedAt       time.Time
+	DecisionToken   string
+	DecisionSession string
+}
+
+type AuthorizationDetailType struct {
+	Type        string    `json:"type"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Actions     []string  `json:"actions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type AuthorizationDetail map[string]any
+
+type NonceRecord struct {
+	ClientID  string
+	NonceHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type SecurityEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	ClientID  string    `json:"client_id"`
+	UserID    string    `json:"user_id"`
+	FamilyID  string    `json:"family_id,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type KnownUserRecord struct {
+	UserID    string
+	Username  string
+	Email     string
+	UpdatedAt time.Time
 }
 
 type ConsentRecord struct {
-	ClientID   string
-	UserID     string
-	Scope      []string
-	GrantedAt  time.Time
-	UpdatedAt  time.Time
-	RevokedAt  *time.Time
-	FirstParty bool
+	ClientID             string
+	UserID               string
+	Scope                []string
+	GrantedAt            time.Time
+	UpdatedAt            time.Time
+	RevokedAt            *time.Time
+	FirstParty           bool
+	OfflineAccess        bool
+	AuthorizationDetails []AuthorizationDetail
 }
 
 type AccessTokenClaims struct {
-	Issuer    string
-	Audience  string
-	Subject   string
-	Scope     []string
-	IssuedAt  time.Time
-	ExpiresAt time.Time
-	TokenUse  string
+	Issuer               string
+	Audience             string
+	ClientID             string
+	Resources            []string
+	Subject              string
+	Scope                []string
+	IssuedAt             time.Time
+	ExpiresAt            time.Time
+	Lifetime             time.Duration
+	TokenUse             string
+	JTI                  string
+	AuthTime             time.Time
+	Roles                []string
+	Groups               []string
+	AuthorizationDetails []AuthorizationDetail
 }
 
 type IDTokenClaims struct {
@@ -84,16 +246,21 @@ type IDTokenClaims struct {
 	Nonce     string
 	IssuedAt  time.Time
 	ExpiresAt time.Time
+	Lifetime  time.Duration
 	AuthTime  time.Time
+	ACR       string
+	AMR       []string
 }
 
 type TokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	TokenType    string `json:"token_type"`
-	ExpiresIn    int64  `json:"expires_in"`
-	RefreshToken string `json:"refresh_token,omitempty"`
-	IDToken      string `json:"id_token,omitempty"`
-	Scope        string `json:"scope,omitempty"`
+	AccessToken          string                `json:"access_token"`
+	TokenType            string                `json:"token_type"`
+	ExpiresIn            int64                 `json:"expires_in"`
+	RefreshToken         string                `json:"refresh_token,omitempty"`
+	RefreshExpiresIn     int64                 `json:"refresh_expires_in,omitempty"`
+	IDToken              string                `json:"id_token,omitempty"`
+	Scope                string                `json:"scope,omitempty"`
+	AuthorizationDetails []AuthorizationDetail `json:"authorization_details,omitempty"`
 }
 
 type OAuthError struct {
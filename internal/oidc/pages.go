@@ -0,0 +1,120 @@
+package oidc
+
+import (
+	"html/template"
+	"strings"
+)
+
+type consentPageData struct {
+	ClientName string
+	Scopes     []string
+	Offline    bool
+	Details    []string
+	TxnID      string
+}
+
+type backchannelPageData struct {
+	Notice   string
+	Requests []backchannelPageRequest
+}
+
+type backchannelPageRequest struct {
+	ID             string
+	Token          string
+	ClientName     string
+	Scopes         []string
+	BindingMessage string
+}
+
+type formPostPageData struct {
+	Action string
+	Params map[string]string
+}
+
+type errorPageData struct {
+	Error       string
+	Description string
+}
+
+var consentPageTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Authorize {{.ClientName}}</title></head>
+<body>
+<h1>{{.ClientName}} wants to access your account</h1>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+{{if .Details}}<p>It also asks for these specific permissions:</p>
+<ul>{{range .Details}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if .Offline}}<p>{{.ClientName}} will keep access while you are signed out, until you disconnect it.</p>{{end}}
+<form method="post" action="authorize/consent">
+<input type="hidden" name="txn" value="{{.TxnID}}">
+<button type="submit" name="decision" value="approve">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body>
+</html>`))
+
+var backchannelPageTemplate = template.Must(template.New("backchannel").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign-in requests</title></head>
+<body>
+<h1>Sign-in requests</h1>
+{{if .Notice}}<p>{{.Notice}}</p>{{end}}
+{{range .Requests}}<section>
+<h2>{{.ClientName}} wants to sign you in</h2>
+{{if .BindingMessage}}<p>Check that the other device shows: <strong>{{.BindingMessage}}</strong></p>{{end}}
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+<form method="post" action="backchannel">
+<input type="hidden" name="id" value="{{.ID}}">
+<input type="hidden" name="csrf_token" value="{{.Token}}">
+<button type="submit" name="decision" value="approve">Approve</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</section>
+{{else}}<p>There are no pending sign-in requests.</p>
+{{end}}</body>
+</html>`))
+
+var errorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Authorization error</title></head>
+<body>
+<h1>This authorization request cannot be completed</h1>
+<p>{{.Description}}</p>
+<p><code>{{.Error}}</code></p>
+</body>
+</html>`))
+
+var formPostPageTemplate = template.Must(template.New("form_post").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Submit this form</title></head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.Action}}">
+{{range $key, $value := .Params}}<input type="hidden" name="{{$key}}" value="{{$value}}">
+{{end}}<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body>
+</html>`))
+
+func renderConsentPage(data consentPageData) (string, error) {
+	return renderPage(consentPageTemplate, data)
+}
+
+func renderBackchannelPage(data backchannelPageData) (string, error) {
+	return renderPage(backchannelPageTemplate, data)
+}
+
+func renderFormPostPage(data formPostPageData) (string, error) {
+	return renderPage(formPostPageTemplate, data)
+}
+
+func renderErrorPage(data errorPageData) (string, error) {
+	return renderPage(errorPageTemplate, data)
+}
+
+func renderPage(tmpl *template.Template, data any) (string, error) {
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
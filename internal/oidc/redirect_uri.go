@@ -0,0 +1,184 @@
+package oidc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const redirectPatternPrefix = "https://*."
+
+type redirectPattern struct {
+	suffix string
+	port   string
+	path   string
+	query  string
+}
+
+func isPrivateUseScheme(scheme string) bool {
+	scheme = strings.ToLower(scheme)
+	return strings.Contains(scheme, ".") && scheme != "http" && scheme != "https"
+}
+
+func isScriptScheme(scheme string) bool {
+	switch strings.ToLower(scheme) {
+	case "javascript", "data", "vbscript", "file":
+		return true
+	}
+	return false
+}
+
+func isLoopbackRedirect(u *url.URL) bool {
+	if u.Scheme != "http" {
+		return false
+	}
+	host := u.Hostname()
+	return host == "127.0.0.1" || host == "::1"
+}
+
+func checkRedirectURI(u *url.URL, public bool) error {
+	if u.Scheme == "" || u.Fragment != "" || u.User != nil {
+		return errors.New("redirect URI must be absolute without fragment or user info")
+	}
+	if strings.EqualFold(u.Hostname(), "localhost") {
+		return errors.New("localhost redirect URIs are not allowed, use 127.0.0.1 or [::1]")
+	}
+	switch {
+	case u.Scheme == "http" || u.Scheme == "https":
+		if u.Host == "" {
+			return errors.New("redirect URI must include a host")
+		}
+	case isPrivateUseScheme(u.Scheme):
+		if !public {
+			return errors.New("private-use URI schemes are only allowed for public clients")
+		}
+	default:
+		return fmt.Errorf("redirect URI scheme %q is not allowed", u.Scheme)
+	}
+	return nil
+}
+
+func validateClientRedirectURIs(uris []string, authMethod string) error {
+	for _, raw := range uris {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("redirect URI %q is invalid", raw)
+		}
+		if err = checkRedirectURI(u, authMethod == "none"); err != nil {
+			return fmt.Errorf("redirect URI %q: %w", raw, err)
+		}
+	}
+	return nil
+}
+
+func ValidateRedirectURI(client OIDCClient, uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme == "" || isScriptScheme(parsed.Scheme) {
+		return ErrInvalidRedirectURI
+	}
+	for _, allowed := range client.RedirectURIs {
+		if redirectURIMatches(allowed, uri) {
+			return nil
+		}
+	}
+	if client.AllowRedirectPatterns {
+		for _, pattern := range client.RedirectURIPatterns {
+			if redirectPatternMatches(pattern, uri) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidRedirectURI
+}
+
+func redirectURIMatches(registered, requested string) bool {
+	if constantTimeEquals(registered, requested) {
+		return true
+	}
+	allowed, err := url.Parse(registered)
+	if err != nil || !isLoopbackRedirect(allowed) {
+		return false
+	}
+	candidate, err := url.Parse(requested)
+	if err != nil || !isLoopbackRedirect(candidate) {
+		return false
+	}
+	return allowed.Hostname() == candidate.Hostname() &&
+		allowed.EscapedPath() == candidate.EscapedPath() &&
+		allowed.RawQuery == candidate.RawQuery &&
+		candidate.Fragment == "" && candidate.User == nil
+}
+
+func parseRedirectPattern(pattern string) (redirectPattern, error) {
+	if !strings.HasPrefix(pattern, redirectPatternPrefix) {
+		return redirectPattern{}, errors.New("redirect URI pattern must start with https://*.")
+	}
+	rest := strings.TrimPrefix(pattern, redirectPatternPrefix)
+	if strings.ContainsAny(rest, "*%\\@#") {
+		return redirectPattern{}, errors.New("redirect URI pattern may only contain a single leading wildcard label")
+	}
+	u, err := url.Parse("https://" + rest)
+	if err != nil || u.Host == "" {
+		return redirectPattern{}, errors.New("redirect URI pattern is invalid")
+	}
+	host := strings.ToLower(u.Hostname())
+	if net.ParseIP(host) != nil {
+		return redirectPattern{}, errors.New("redirect URI pattern must not use an IP address")
+	}
+	for _, label := range strings.Split(host, ".") {
+		if !validDNSLabel(label) {
+			return redirectPattern{}, fmt.Errorf("redirect URI pattern host label %q is invalid", label)
+		}
+	}
+	if _, err = publicsuffix.EffectiveTLDPlusOne(host); err != nil {
+		return redirectPattern{}, errors.New("redirect URI pattern must not wildcard the registrable domain")
+	}
+	if !strings.HasPrefix(u.EscapedPath(), "/") {
+		return redirectPattern{}, errors.New("redirect URI pattern must include a fixed path")
+	}
+	return redirectPattern{suffix: host, port: u.Port(), path: u.EscapedPath(), query: u.RawQuery}, nil
+}
+
+func validateRedirectURIPatterns(patterns []string, allowed bool) error {
+	if len(patterns) > 0 && !allowed {
+		return errors.New("redirect_uri_patterns require allow_redirect_patterns")
+	}
+	for _, pattern := range patterns {
+		if _, err := parseRedirectPattern(strings.TrimSpace(pattern)); err != nil {
+			return fmt.Errorf("redirect URI pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func redirectPatternMatches(pattern, requested string) bool {
+	parsed, err := parseRedirectPattern(pattern)
+	if err != nil || strings.Contains(requested, "\\") {
+		return false
+	}
+	u, err := url.Parse(requested)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Fragment != "" || strings.Contains(u.Host, "%") {
+		return false
+	}
+	label, ok := strings.CutSuffix(strings.ToLower(u.Hostname()), "."+parsed.suffix)
+	if !ok || !validDNSLabel(label) {
+		return false
+	}
+	return u.Port() == parsed.port && u.EscapedPath() == parsed.path && u.RawQuery == parsed.query
+}
+
+func validDNSLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, r := range label {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
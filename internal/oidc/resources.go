@@ -0,0 +1,90 @@
+package oidc
+
+import (
+	"errors"
+	"net/url"
+)
+
+var ErrInvalidTarget = errors.New("resource is invalid or not registered")
+
+func validateResourceIndicator(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" || u.RawFragment != "" {
+		return ErrInvalidTarget
+	}
+	return nil
+}
+
+func resolveResources(store Store, uris []string) ([]ProtectedResource, error) {
+	out := make([]ProtectedResource, 0, len(uris))
+	for _, uri := range uris {
+		if err := validateResourceIndicator(uri); err != nil {
+			return nil, err
+		}
+		resource, err := store.GetResource(uri)
+		if err != nil {
+			return nil, ErrInvalidTarget
+		}
+		out = append(out, resource)
+	}
+	return out, nil
+}
+
+func resourceScope(scope []string, resources []ProtectedResource) []string {
+	out := make([]string, 0, len(scope))
+	for _, value := range scope {
+		for _, resource := range resources {
+			if containsValue(resource.Scopes, value) {
+				out = append(out, value)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func audienceClaim(resources []string, clientID string) any {
+	switch len(resources) {
+	case 0:
+		return clientID
+	case 1:
+		return resources[0]
+	}
+	return resources
+}
+
+func tokenAudiences(claims TokenClaims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []string:
+		return aud
+	case []any:
+		out := make([]string, 0, len(aud))
+		for _, value := range aud {
+			if s, ok := value.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func isTokenResourceClient(store Store, claims TokenClaims, clientID string) bool {
+	for _, audience := range tokenAudiences(claims) {
+		resource, err := store.GetResource(audience)
+		if err == nil && resource.ClientID != "" && constantTimeEquals(resource.ClientID, clientID) {
+			return true
+		}
+	}
+	return false
+}
+
+func tokenClientID(claims TokenClaims) string {
+	if clientID, _ := claims["client_id"].(string); clientID != "" {
+		return clientID
+	}
+	audience, _ := claims["aud"].(string)
+	return audience
+}
@@ -0,0 +1,70 @@
+package oidc
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+func isSupportedResponseMode(mode string) bool {
+	return containsValue(supportedResponseModes, mode)
+}
+
+func resolveResponseMode(req AuthorizeRequest, client OIDCClient) (AuthorizeRequest, error) {
+	if req.ResponseMode == "" {
+		req.ResponseMode = client.DefaultResponseMode
+	}
+	if req.ResponseMode == "" && client.AuthorizationSignedResponseAlg != "" {
+		req.ResponseMode = "jwt"
+	}
+	if req.ResponseMode == "" {
+		req.ResponseMode = "query"
+	}
+	if !isSupportedResponseMode(req.ResponseMode) {
+		req.ResponseMode = "query"
+		return req, errors.New("response_mode is not supported")
+	}
+	if req.ResponseMode == "jwt" {
+		req.ResponseMode = "query.jwt"
+	}
+	if strings.HasPrefix(req.ResponseMode, "form_post") {
+		if u, err := url.Parse(req.RedirectURI); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			req.ResponseMode = "query"
+			return req, errors.New("form_post requires an http or https redirect_uri")
+		}
+	}
+	return req, nil
+}
+
+func isJWTResponseMode(mode string) bool {
+	return strings.HasSuffix(mode, ".jwt")
+}
+
+func isSupportedAuthorizationSigningAlg(alg string) bool {
+	return containsValue(supportedAuthorizationSigningAlgs, alg)
+}
+
+func appendRedirectFragment(base string, values map[string]string) (string, error) {
+	u, err := parseRedirectTarget(base)
+	if err != nil {
+		return "", err
+	}
+	fragment := url.Values{}
+	for key, value := range values {
+		fragment.Set(key, value)
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String() + "#" + fragment.Encode(), nil
+}
+
+func parseRedirectTarget(base string) (*url.URL, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || isScriptScheme(u.Scheme) {
+		return nil, errors.New("invalid redirect uri")
+	}
+	return u, nil
+}
@@ -15,13 +15,25 @@ var (
 	ErrClientInactive        = errors.New("client is inactive")
 	ErrUnsupportedGrantType  = errors.New("client does not allow grant type")
 	ErrConsentNotFound       = errors.New("consent not found")
+	ErrAuthorizeTxnNotFound  = errors.New("authorization request not found")
+	ErrAuthorizeTxnExpired   = errors.New("authorization request expired")
+	ErrLoginSessionNotFound  = errors.New("login session not found")
 	ErrAuthCodeNotFound      = errors.New("authorization code not found")
 	ErrAuthCodeExpired       = errors.New("authorization code expired")
 	ErrAuthCodeConsumed      = errors.New("authorization code already consumed")
+	ErrAccessTokenNotFound   = errors.New("access token not found")
+	ErrAccessTokenExpired    = errors.New("access token expired")
+	ErrAccessTokenRevoked    = errors.New("access token revoked")
 	ErrRefreshTokenNotFound  = errors.New("refresh token not found")
 	ErrRefreshTokenExpired   = errors.New("refresh token expired")
 	ErrRefreshTokenRevoked   = errors.New("refresh token revoked")
 	ErrRefreshTokenReplay    = errors.New("refresh token replay detected")
+	ErrNonceReplay           = errors.New("nonce has already been used")
+	ErrBackchannelNotFound   = errors.New("backchannel authentication request not found")
+	ErrBackchannelExpired    = errors.New("backchannel authentication request expired")
+	ErrResourceNotFound      = errors.New("resource not found")
+	ErrDetailTypeNotFound    = errors.New("authorization details type not found")
+	ErrKnownUserNotFound     = errors.New("known user not found")
 	ErrInvalidRedirectURI    = errors.New("invalid redirect uri")
 	ErrInvalidRequestedScope = errors.New("invalid scope")
 )
@@ -34,32 +46,92 @@ type Store interface {
 	DeleteClient(id string) error
 	ValidateClientSecret(clientID, rawSecret string) (OIDCClient, error)
 
+	SaveResource(resource ProtectedResource) (ProtectedResource, error)
+	GetResource(uri string) (ProtectedResource, error)
+	ListResources() []ProtectedResource
+	DeleteResource(uri string) error
+
+	SaveAuthorizationDetailType(detailType AuthorizationDetailType) (AuthorizationDetailType, error)
+	GetAuthorizationDetailType(name string) (AuthorizationDetailType, error)
+	ListAuthorizationDetailTypes() []AuthorizationDetailType
+	DeleteAuthorizationDetailType(name string) error
+
+	SaveAuthorizeTransaction(record AuthorizeTransaction) error
+	GetAuthorizeTransaction(rawID string, now time.Time) (AuthorizeTransaction, error)
+	DeleteAuthorizeTransaction(rawID string) error
+
+	SaveLoginSession(record LoginSessionRecord) error
+	GetLoginSession(sessionHash string) (LoginSessionRecord, error)
+
 	SaveAuthCode(record AuthCodeRecord) error
 	ConsumeAuthCode(rawCode string, now time.Time) (AuthCodeRecord, error)
 
+	SaveAccessToken(record AccessTokenRecord) error
+	GetAccessToken(rawToken string, now time.Time) (AccessTokenRecord, error)
+	RevokeAccessToken(rawToken string, now time.Time) error
+	DenyAccessToken(record DeniedAccessTokenRecord) error
+	IsAccessTokenDenied(jti string, now time.Time) (bool, error)
+
 	SaveRefreshToken(record RefreshTokenRecord) error
 	GetRefreshToken(rawToken string, now time.Time) (RefreshTokenRecord, error)
+	GetRefreshTokenByHash(tokenHash string, now time.Time) (RefreshTokenRecord, error)
 	RevokeRefreshToken(rawToken string, now time.Time) error
 	RotateRefreshToken(oldRawToken string, newRecord RefreshTokenRecord, now time.Time) error
+	RevokeRefreshTokenFamily(familyID string, now time.Time) error
+
+	UseNonce(record NonceRecord, now time.Time) error
+
+	SaveBackchannelRequest(record BackchannelAuthRequest) error
+	GetBackchannelRequest(idHash string, now time.Time) (BackchannelAuthRequest, error)
+	ListBackchannelRequests(userID string, now time.Time) []BackchannelAuthRequest
+	UpdateBackchannelPoll(idHash string, polledAt time.Time, interval int64) error
+	SetBackchannelDecisionToken(idHash, tokenHash, sessionHash string) error
+	DeleteBackchannelRequest(idHash string) error
+
+	RecordSecurityEvent(event SecurityEvent) error
+	ListSecurityEvents() []SecurityEvent
 
 	SaveConsent(record ConsentRecord) error
 	GetConsent(clientID, userID string) (ConsentRecord, error)
+	ListConsents(userID string) []ConsentRecord
+
+	SaveKnownUser(record KnownUserRecord) error
+	FindKnownUser(hint string) (KnownUserRecord, error)
 }
 
 type InMemoryStore struct {
 	mu            sync.RWMutex
 	clients       map[string]OIDCClient
+	authorizeTxns map[string]AuthorizeTransaction
+	loginSessions map[string]LoginSessionRecord
 	authCodes     map[string]AuthCodeRecord
+	accessTokens  map[string]AccessTokenRecord
+	deniedTokens  map[string]DeniedAccessTokenRecord
+	nonces        map[string]NonceRecord
+	backchannel   map[string]BackchannelAuthRequest
+	resources     map[string]ProtectedResource
+	detailTypes   map[string]AuthorizationDetailType
 	refreshTokens map[string]RefreshTokenRecord
+	events        []SecurityEvent
 	consents      map[string]ConsentRecord
+	knownUsers    map[string]KnownUserRecord
 }
 
 func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore{
 		clients:       make(map[string]OIDCClient),
+		authorizeTxns: make(map[string]AuthorizeTransaction),
+		loginSessions: make(map[string]LoginSessionRecord),
 		authCodes:     make(map[string]AuthCodeRecord),
+		accessTokens:  make(map[string]AccessTokenRecord),
+		deniedTokens:  make(map[string]DeniedAccessTokenRecord),
+		nonces:        make(map[string]NonceRecord),
+		backchannel:   make(map[string]BackchannelAuthRequest),
+		resources:     make(map[string]ProtectedResource),
+		detailTypes:   make(map[string]AuthorizationDetailType),
 		refreshTokens: make(map[string]RefreshTokenRecord),
 		consents:      make(map[string]ConsentRecord),
+		knownUsers:    make(map[string]KnownUserRecord),
 	}
 }
 
@@ -89,6 +161,7 @@ func (s *InMemoryStore) CreateClient(client OIDCClient, rawSecret string) (OIDCC
 	client.SecretHash = sha256Hex(rawSecret)
 	client.Scopes = normalizeScopes(client.Scopes)
 	client.RedirectURIs = normalizeScopes(client.RedirectURIs)
+	client.RedirectURIPatterns = normalizeScopes(client.RedirectURIPatterns)
 	client.GrantTypes = normalizeScopes(client.GrantTypes)
 	if len(client.GrantTypes) == 0 {
 		client.GrantTypes = []string{"authorization_code", "refresh_token"}
@@ -153,7 +226,18 @@ func (s *InMemoryStore) UpdateClient(client OIDCClient) (OIDCClient, error) {
 	if client.Status != "" {
 		current.Status = client.Status
 	}
+	current.DefaultResponseMode = client.DefaultResponseMode
+	current.AuthorizationSignedResponseAlg = client.AuthorizationSignedResponseAlg
+	current.AccessTokenFormat = client.AccessTokenFormat
+	current.AccessTokenTTLSeconds = client.AccessTokenTTLSeconds
+	current.IDTokenTTLSeconds = client.IDTokenTTLSeconds
+	current.AuthorizationCodeTTLSeconds = client.AuthorizationCodeTTLSeconds
+	current.RefreshTokenTTLSeconds = client.RefreshTokenTTLSeconds
+	current.RefreshTokenMaxLifetimeSeconds = client.RefreshTokenMaxLifetimeSeconds
+	current.RedirectURIPatterns = normalizeScopes(client.RedirectURIPatterns)
+	current.AllowRedirectPatterns = client.AllowRedirectPatterns
 	current.FirstParty = client.FirstParty
+	current.RequireNonce = client.RequireNonce
 	current.UpdatedAt = time.Now().UTC()
 	s.clients[current.ID] = current
 	return current, nil
@@ -169,6 +253,100 @@ func (s *InMemoryStore) DeleteClient(id string) error {
 	return nil
 }
 
+func (s *InMemoryStore) SaveResource(resource ProtectedResource) (ProtectedResource, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	resource.Scopes = normalizeScopes(resource.Scopes)
+	resource.CreatedAt = now
+	if existing, ok := s.resources[resource.URI]; ok {
+		resource.CreatedAt = existing.CreatedAt
+	}
+	resource.UpdatedAt = now
+	s.resources[resource.URI] = resource
+	return resource, nil
+}
+
+func (s *InMemoryStore) GetResource(uri string) (ProtectedResource, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	resource, ok := s.resources[uri]
+	if !ok {
+		return ProtectedResource{}, ErrResourceNotFound
+	}
+	return resource, nil
+}
+
+func (s *InMemoryStore) ListResources() []ProtectedResource {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]ProtectedResource, 0, len(s.resources))
+	for _, resource := range s.resources {
+		out = append(out, resource)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out
+}
+
+func (s *InMemoryStore) DeleteResource(uri string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.resources[uri]; !ok {
+		return ErrResourceNotFound
+	}
+	delete(s.resources, uri)
+	return nil
+}
+
+func (s *InMemoryStore) SaveAuthorizationDetailType(detailType AuthorizationDetailType) (AuthorizationDetailType, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	detailType.Actions = normalizeScopes(detailType.Actions)
+	detailType.CreatedAt = now
+	if existing, ok := s.detailTypes[detailType.Type]; ok {
+		detailType.CreatedAt = existing.CreatedAt
+	}
+	detailType.UpdatedAt = now
+	s.detailTypes[detailType.Type] = detailType
+	return detailType, nil
+}
+
+func (s *InMemoryStore) GetAuthorizationDetailType(name string) (AuthorizationDetailType, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	detailType, ok := s.detailTypes[name]
+	if !ok {
+		return AuthorizationDetailType{}, ErrDetailTypeNotFound
+	}
+	return detailType, nil
+}
+
+func (s *InMemoryStore) ListAuthorizationDetailTypes() []AuthorizationDetailType {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]AuthorizationDetailType, 0, len(s.detailTypes))
+	for _, detailType := range s.detailTypes {
+		out = append(out, detailType)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out
+}
+
+func (s *InMemoryStore) DeleteAuthorizationDetailType(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.detailTypes[name]; !ok {
+		return ErrDetailTypeNotFound
+	}
+	delete(s.detailTypes, name)
+	return nil
+}
+
 func (s *InMemoryStore) ValidateClientSecret(clientID, rawSecret string) (OIDCClient, error) {
 	client, err := s.GetClient(clientID)
 	if err != nil {
@@ -189,6 +367,50 @@ func (s *InMemoryStore) ValidateClientSecret(clientID, rawSecret string) (OIDCCl
 	return client, nil
 }
 
+func (s *InMemoryStore) SaveAuthorizeTransaction(record AuthorizeTransaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authorizeTxns[record.IDHash] = record
+	return nil
+}
+
+func (s *InMemoryStore) GetAuthorizeTransaction(rawID string, now time.Time) (AuthorizeTransaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.authorizeTxns[sha256Hex(rawID)]
+	if !ok {
+		return AuthorizeTransaction{}, ErrAuthorizeTxnNotFound
+	}
+	if now.After(record.ExpiresAt) {
+		return AuthorizeTransaction{}, ErrAuthorizeTxnExpired
+	}
+	return record, nil
+}
+
+func (s *InMemoryStore) DeleteAuthorizeTransaction(rawID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.authorizeTxns, sha256Hex(rawID))
+	return nil
+}
+
+func (s *InMemoryStore) SaveLoginSession(record LoginSessionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loginSessions[record.SessionHash] = record
+	return nil
+}
+
+func (s *InMemoryStore) GetLoginSession(sessionHash string) (LoginSessionRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.loginSessions[sessionHash]
+	if !ok {
+		return LoginSessionRecord{}, ErrLoginSessionNotFound
+	}
+	return record, nil
+}
+
 func (s *InMemoryStore) SaveAuthCode(record AuthCodeRecord) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -216,6 +438,78 @@ func (s *InMemoryStore) ConsumeAuthCode(rawCode string, now time.Time) (AuthCode
 	return record, nil
 }
 
+func (s *InMemoryStore) SaveAccessToken(record AccessTokenRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessTokens[record.TokenHash] = record
+	return nil
+}
+
+func (s *InMemoryStore) GetAccessToken(rawToken string, now time.Time) (AccessTokenRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.accessTokens[sha256Hex(rawToken)]
+	if !ok {
+		return AccessTokenRecord{}, ErrAccessTokenNotFound
+	}
+	if record.RevokedAt != nil {
+		return AccessTokenRecord{}, ErrAccessTokenRevoked
+	}
+	if now.After(record.ExpiresAt) {
+		return AccessTokenRecord{}, ErrAccessTokenExpired
+	}
+	return record, nil
+}
+
+func (s *InMemoryStore) RevokeAccessToken(rawToken string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash := sha256Hex(rawToken)
+	record, ok := s.accessTokens[hash]
+	if !ok || record.RevokedAt != nil {
+		return nil
+	}
+	revoked := now.UTC()
+	record.RevokedAt = &revoked
+	s.accessTokens[hash] = record
+	return nil
+}
+
+func (s *InMemoryStore) DenyAccessToken(record DeniedAccessTokenRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for jti, denied := range s.deniedTokens {
+		if record.RevokedAt.After(denied.ExpiresAt) {
+			delete(s.deniedTokens, jti)
+		}
+	}
+	s.deniedTokens[record.JTI] = record
+	return nil
+}
+
+func (s *InMemoryStore) IsAccessTokenDenied(jti string, now time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.deniedTokens[jti]
+	return ok && !now.After(record.ExpiresAt), nil
+}
+
+func (s *InMemoryStore) UseNonce(record NonceRecord, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, used := range s.nonces {
+		if now.After(used.ExpiresAt) {
+			delete(s.nonces, key)
+		}
+	}
+	key := nonceMapKey(record.ClientID, record.NonceHash)
+	if _, ok := s.nonces[key]; ok {
+		return ErrNonceReplay
+	}
+	s.nonces[key] = record
+	return nil
+}
+
 func (s *InMemoryStore) SaveRefreshToken(record RefreshTokenRecord) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -224,15 +518,18 @@ func (s *InMemoryStore) SaveRefreshToken(record RefreshTokenRecord) error {
 }
 
 func (s *InMemoryStore) GetRefreshToken(rawToken string, now time.Time) (RefreshTokenRecord, error) {
+	return s.GetRefreshTokenByHash(sha256Hex(rawToken), now)
+}
+
+func (s *InMemoryStore) GetRefreshTokenByHash(tokenHash string, now time.Time) (RefreshTokenRecord, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	hash := sha256Hex(rawToken)
-	record, ok := s.refreshTokens[hash]
+	record, ok := s.refreshTokens[tokenHash]
 	if !ok {
 		return RefreshTokenRecord{}, ErrRefreshTokenNotFound
 	}
 	if record.RevokedAt != nil {
-		return RefreshTokenRecord{}, ErrRefreshTokenRevoked
+		return record, ErrRefreshTokenRevoked
 	}
 	if now.After(record.ExpiresAt) {
 		return RefreshTokenRecord{}, ErrRefreshTokenExpired
@@ -270,11 +567,124 @@ func (s *InMemoryStore) RotateRefreshToken(oldRawToken string, newRecord Refresh
 	}
 	revoked := now.UTC()
 	oldRecord.RevokedAt = &revoked
+	oldRecord.ReplacedBy = newRecord.TokenHash
 	s.refreshTokens[oldHash] = oldRecord
 	s.refreshTokens[newRecord.TokenHash] = newRecord
 	return nil
 }
 
+func (s *InMemoryStore) RevokeRefreshTokenFamily(familyID string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revoked := now.UTC()
+	for hash, record := range s.refreshTokens {
+		if record.FamilyID != familyID || record.RevokedAt != nil {
+			continue
+		}
+		record.RevokedAt = &revoked
+		s.refreshTokens[hash] = record
+	}
+	return nil
+}
+
+func (s *InMemoryStore) RecordSecurityEvent(event SecurityEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *InMemoryStore) ListSecurityEvents() []SecurityEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := append([]SecurityEvent(nil), s.events...)
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	return out
+}
+
+func (s *InMemoryStore) SaveBackchannelRequest(record BackchannelAuthRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backchannel[record.IDHash] = record
+	return nil
+}
+
+func (s *InMemoryStore) UpdateBackchannelPoll(idHash string, polledAt time.Time, interval int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.backchannel[idHash]
+	if !ok {
+		return ErrBackchannelNotFound
+	}
+	if record.Status != backchannelStatusPending {
+		return nil
+	}
+	record.LastPolledAt = polledAt
+	record.Interval = interval
+	s.backchannel[idHash] = record
+	return nil
+}
+
+func (s *InMemoryStore) SetBackchannelDecisionToken(idHash, tokenHash, sessionHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.backchannel[idHash]
+	if !ok {
+		return ErrBackchannelNotFound
+	}
+	if record.Status != backchannelStatusPending {
+		return nil
+	}
+	record.DecisionToken = tokenHash
+	record.DecisionSession = sessionHash
+	s.backchannel[idHash] = record
+	return nil
+}
+
+func (s *InMemoryStore) GetBackchannelRequest(idHash string, now time.Time) (BackchannelAuthRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, ok := s.backchannel[idHash]
+	if !ok {
+		return BackchannelAuthRequest{}, ErrBackchannelNotFound
+	}
+	if now.After(record.ExpiresAt) {
+		return BackchannelAuthRequest{}, ErrBackchannelExpired
+	}
+	return record, nil
+}
+
+func (s *InMemoryStore) ListBackchannelRequests(userID string, now time.Time) []BackchannelAuthRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]BackchannelAuthRequest, 0)
+	for key, record := range s.backchannel {
+		if now.After(record.ExpiresAt) {
+			delete(s.backchannel, key)
+			continue
+		}
+		if record.UserID == userID && record.Status == backchannelStatusPending {
+			out = append(out, record)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out
+}
+
+func (s *InMemoryStore) DeleteBackchannelRequest(idHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.backchannel[idHash]; !ok {
+		return ErrBackchannelNotFound
+	}
+	delete(s.backchannel, idHash)
+	return nil
+}
+
 func (s *InMemoryStore) SaveConsent(record ConsentRecord) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -299,13 +709,19 @@ func (s *InMemoryStore) GetConsent(clientID, userID string) (ConsentRecord, erro
 	return record, nil
 }
 
-func ValidateRedirectURI(client OIDCClient, uri string) error {
-	for _, allowed := range client.RedirectURIs {
-		if constantTimeEquals(allowed, uri) {
-			return nil
+func (s *InMemoryStore) ListConsents(userID string) []ConsentRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]ConsentRecord, 0)
+	for _, record := range s.consents {
+		if record.UserID == userID {
+			out = append(out, record)
 		}
 	}
-	return ErrInvalidRedirectURI
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].UpdatedAt.After(out[j].UpdatedAt)
+	})
+	return out
 }
 
 func ValidateScopes(client OIDCClient, requested []string) error {
@@ -342,6 +758,37 @@ func ClientAllowsGrantType(client OIDCClient, grantType string) bool {
 	return false
 }
 
+func (s *InMemoryStore) SaveKnownUser(record KnownUserRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record.UpdatedAt = time.Now().UTC()
+	s.knownUsers[record.UserID] = record
+	if record.Email != "" {
+		s.knownUsers[knownUserEmailKey(record.Email)] = record
+	}
+	return nil
+}
+
+func (s *InMemoryStore) FindKnownUser(hint string) (KnownUserRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if record, ok := s.knownUsers[hint]; ok {
+		return record, nil
+	}
+	if record, ok := s.knownUsers[knownUserEmailKey(hint)]; ok {
+		return record, nil
+	}
+	return KnownUserRecord{}, ErrKnownUserNotFound
+}
+
+func knownUserEmailKey(email string) string {
+	return "email:" + sha256Hex(strings.ToLower(strings.TrimSpace(email)))
+}
+
+func nonceMapKey(clientID, nonceHash string) string {
+	return clientID + "::" + nonceHash
+}
+
 func consentMapKey(clientID, userID string) string {
 	return clientID + "::" + userID
 }
@@ -14,19 +14,39 @@ import (
 
 const (
 	kvGroupClients       = "oidc_clients"
+	kvGroupAuthorizeTxns = "oidc_authorize_txns"
+	kvGroupLoginSessions = "oidc_login_sessions"
 	kvGroupAuthCodes     = "oidc_auth_codes"
+	kvGroupAccessTokens  = "oidc_access_tokens"
+	kvGroupDeniedTokens  = "oidc_denied_access_tokens"
 	kvGroupRefreshTokens = "oidc_refresh_tokens"
+	kvGroupRefreshFamily = "oidc_refresh_token_families"
 	kvGroupConsents      = "oidc_consents"
+	kvGroupNonces        = "oidc_nonces"
+	kvGroupBackchannel   = "oidc_backchannel_requests"
+	kvGroupResources     = "oidc_resources"
+	kvGroupDetailTypes   = "oidc_authorization_detail_types"
+	kvGroupEvents        = "oidc_security_events"
+	kvGroupKnownUsers    = "oidc_known_users"
 	kvPageSize           = 200
+	kvSweepInterval      = 10 * time.Minute
+	kvLoginSessionTTL    = 7 * 24 * time.Hour
 )
 
+type kvRefreshFamily struct {
+	FamilyID    string
+	TokenHashes []string
+	ExpiresAt   time.Time
+}
+
 type KVStore struct {
 	operator *answerplugin.KVOperator
 	mu       sync.Mutex
+	sweptAt  map[string]time.Time
 }
 
 func NewKVStore(operator *answerplugin.KVOperator) *KVStore {
-	return &KVStore{operator: operator}
+	return &KVStore{operator: operator, sweptAt: make(map[string]time.Time)}
 }
 
 func (s *KVStore) CreateClient(client OIDCClient, rawSecret string) (OIDCClient, string, error) {
@@ -68,6 +88,7 @@ func (s *KVStore) CreateClient(client OIDCClient, rawSecret string) (OIDCClient,
 	client.SecretHash = sha256Hex(rawSecret)
 	client.Scopes = normalizeScopes(client.Scopes)
 	client.RedirectURIs = normalizeScopes(client.RedirectURIs)
+	client.RedirectURIPatterns = normalizeScopes(client.RedirectURIPatterns)
 	client.GrantTypes = normalizeScopes(client.GrantTypes)
 	if len(client.GrantTypes) == 0 {
 		client.GrantTypes = []string{"authorization_code", "refresh_token"}
@@ -140,7 +161,18 @@ func (s *KVStore) UpdateClient(client OIDCClient) (OIDCClient, error) {
 	if client.Status != "" {
 		current.Status = client.Status
 	}
+	current.DefaultResponseMode = client.DefaultResponseMode
+	current.AuthorizationSignedResponseAlg = client.AuthorizationSignedResponseAlg
+	current.AccessTokenFormat = client.AccessTokenFormat
+	current.AccessTokenTTLSeconds = client.AccessTokenTTLSeconds
+	current.IDTokenTTLSeconds = client.IDTokenTTLSeconds
+	current.AuthorizationCodeTTLSeconds = client.AuthorizationCodeTTLSeconds
+	current.RefreshTokenTTLSeconds = client.RefreshTokenTTLSeconds
+	current.RefreshTokenMaxLifetimeSeconds = client.RefreshTokenMaxLifetimeSeconds
+	current.RedirectURIPatterns = normalizeScopes(client.RedirectURIPatterns)
+	current.AllowRedirectPatterns = client.AllowRedirectPatterns
 	current.FirstParty = client.FirstParty
+	current.RequireNonce = client.RequireNonce
 	current.UpdatedAt = time.Now().UTC()
 
 	if err = s.saveJSON(kvGroupClients, current.ID, current); err != nil {
@@ -156,6 +188,108 @@ func (s *KVStore) DeleteClient(id string) error {
 	return s.operator.Del(context.Background(), answerplugin.KVParams{Group: kvGroupClients, Key: id})
 }
 
+func (s *KVStore) SaveResource(resource ProtectedResource) (ProtectedResource, error) {
+	now := time.Now().UTC()
+	resource.Scopes = normalizeScopes(resource.Scopes)
+	resource.CreatedAt = now
+	if existing, err := s.GetResource(resource.URI); err == nil {
+		resource.CreatedAt = existing.CreatedAt
+	}
+	resource.UpdatedAt = now
+	if err := s.saveJSON(kvGroupResources, sha256Hex(resource.URI), resource); err != nil {
+		return ProtectedResource{}, err
+	}
+	return resource, nil
+}
+
+func (s *KVStore) GetResource(uri string) (ProtectedResource, error) {
+	resource := ProtectedResource{}
+	err := s.getJSON(kvGroupResources, sha256Hex(uri), &resource)
+	if err != nil {
+		if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+			return ProtectedResource{}, ErrResourceNotFound
+		}
+		return ProtectedResource{}, err
+	}
+	return resource, nil
+}
+
+func (s *KVStore) ListResources() []ProtectedResource {
+	rows, err := s.listJSON(kvGroupResources)
+	if err != nil {
+		return nil
+	}
+	out := make([]ProtectedResource, 0, len(rows))
+	for _, raw := range rows {
+		resource := ProtectedResource{}
+		if err = json.Unmarshal([]byte(raw), &resource); err == nil {
+			out = append(out, resource)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out
+}
+
+func (s *KVStore) DeleteResource(uri string) error {
+	if _, err := s.GetResource(uri); err != nil {
+		return err
+	}
+	return s.operator.Del(context.Background(), answerplugin.KVParams{Group: kvGroupResources, Key: sha256Hex(uri)})
+}
+
+func (s *KVStore) SaveAuthorizationDetailType(detailType AuthorizationDetailType) (AuthorizationDetailType, error) {
+	now := time.Now().UTC()
+	detailType.Actions = normalizeScopes(detailType.Actions)
+	detailType.CreatedAt = now
+	if existing, err := s.GetAuthorizationDetailType(detailType.Type); err == nil {
+		detailType.CreatedAt = existing.CreatedAt
+	}
+	detailType.UpdatedAt = now
+	if err := s.saveJSON(kvGroupDetailTypes, sha256Hex(detailType.Type), detailType); err != nil {
+		return AuthorizationDetailType{}, err
+	}
+	return detailType, nil
+}
+
+func (s *KVStore) GetAuthorizationDetailType(name string) (AuthorizationDetailType, error) {
+	detailType := AuthorizationDetailType{}
+	err := s.getJSON(kvGroupDetailTypes, sha256Hex(name), &detailType)
+	if err != nil {
+		if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+			return AuthorizationDetailType{}, ErrDetailTypeNotFound
+		}
+		return AuthorizationDetailType{}, err
+	}
+	return detailType, nil
+}
+
+func (s *KVStore) ListAuthorizationDetailTypes() []AuthorizationDetailType {
+	rows, err := s.listJSON(kvGroupDetailTypes)
+	if err != nil {
+		return nil
+	}
+	out := make([]AuthorizationDetailType, 0, len(rows))
+	for _, raw := range rows {
+		detailType := AuthorizationDetailType{}
+		if err = json.Unmarshal([]byte(raw), &detailType); err == nil {
+			out = append(out, detailType)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out
+}
+
+func (s *KVStore) DeleteAuthorizationDetailType(name string) error {
+	if _, err := s.GetAuthorizationDetailType(name); err != nil {
+		return err
+	}
+	return s.operator.Del(context.Background(), answerplugin.KVParams{Group: kvGroupDetailTypes, Key: sha256Hex(name)})
+}
+
 func (s *KVStore) ValidateClientSecret(clientID, rawSecret string) (OIDCClient, error) {
 	client, err := s.GetClient(clientID)
 	if err != nil {
@@ -176,6 +310,55 @@ func (s *KVStore) ValidateClientSecret(clientID, rawSecret string) (OIDCClient,
 	return client, nil
 }
 
+func (s *KVStore) SaveAuthorizeTransaction(record AuthorizeTransaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.sweepExpired(kvGroupAuthorizeTxns, time.Now().UTC()); err != nil {
+		return err
+	}
+	return s.saveJSON(kvGroupAuthorizeTxns, record.IDHash, record)
+}
+
+func (s *KVStore) GetAuthorizeTransaction(rawID string, now time.Time) (AuthorizeTransaction, error) {
+	record := AuthorizeTransaction{}
+	err := s.getJSON(kvGroupAuthorizeTxns, sha256Hex(rawID), &record)
+	if err != nil {
+		if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+			return AuthorizeTransaction{}, ErrAuthorizeTxnNotFound
+		}
+		return AuthorizeTransaction{}, err
+	}
+	if now.After(record.ExpiresAt) {
+		return AuthorizeTransaction{}, ErrAuthorizeTxnExpired
+	}
+	return record, nil
+}
+
+func (s *KVStore) DeleteAuthorizeTransaction(rawID string) error {
+	return s.operator.Del(context.Background(), answerplugin.KVParams{Group: kvGroupAuthorizeTxns, Key: sha256Hex(rawID)})
+}
+
+func (s *KVStore) SaveLoginSession(record LoginSessionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.sweepLoginSessions(time.Now().UTC()); err != nil {
+		return err
+	}
+	return s.saveJSON(kvGroupLoginSessions, record.SessionHash, record)
+}
+
+func (s *KVStore) GetLoginSession(sessionHash string) (LoginSessionRecord, error) {
+	record := LoginSessionRecord{}
+	err := s.getJSON(kvGroupLoginSessions, sessionHash, &record)
+	if err != nil {
+		if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+			return LoginSessionRecord{}, ErrLoginSessionNotFound
+		}
+		return LoginSessionRecord{}, err
+	}
+	return record, nil
+}
+
 func (s *KVStore) SaveAuthCode(record AuthCodeRecord) error {
 	return s.saveJSON(kvGroupAuthCodes, record.CodeHash, record)
 }
@@ -206,12 +389,202 @@ func (s *KVStore) ConsumeAuthCode(rawCode string, now time.Time) (AuthCodeRecord
 	return record, nil
 }
 
+func (s *KVStore) SaveAccessToken(record AccessTokenRecord) error {
+	return s.saveJSON(kvGroupAccessTokens, record.TokenHash, record)
+}
+
+func (s *KVStore) GetAccessToken(rawToken string, now time.Time) (AccessTokenRecord, error) {
+	record := AccessTokenRecord{}
+	err := s.getJSON(kvGroupAccessTokens, sha256Hex(rawToken), &record)
+	if err != nil {
+		if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+			return AccessTokenRecord{}, ErrAccessTokenNotFound
+		}
+		return AccessTokenRecord{}, err
+	}
+	if record.RevokedAt != nil {
+		return AccessTokenRecord{}, ErrAccessTokenRevoked
+	}
+	if now.After(record.ExpiresAt) {
+		return AccessTokenRecord{}, ErrAccessTokenExpired
+	}
+	return record, nil
+}
+
+func (s *KVStore) RevokeAccessToken(rawToken string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokenHash := sha256Hex(rawToken)
+	record := AccessTokenRecord{}
+	err := s.getJSON(kvGroupAccessTokens, tokenHash, &record)
+	if err != nil {
+		if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+	if record.RevokedAt != nil {
+		return nil
+	}
+	revoked := now.UTC()
+	record.RevokedAt = &revoked
+	return s.saveJSON(kvGroupAccessTokens, tokenHash, record)
+}
+
+func (s *KVStore) DenyAccessToken(record DeniedAccessTokenRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.sweepExpired(kvGroupDeniedTokens, record.RevokedAt); err != nil {
+		return err
+	}
+	return s.saveJSON(kvGroupDeniedTokens, record.JTI, record)
+}
+
+func (s *KVStore) IsAccessTokenDenied(jti string, now time.Time) (bool, error) {
+	record := DeniedAccessTokenRecord{}
+	err := s.getJSON(kvGroupDeniedTokens, jti, &record)
+	if err != nil {
+		if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if now.After(record.ExpiresAt) {
+		return false, s.operator.Del(context.Background(), answerplugin.KVParams{Group: kvGroupDeniedTokens, Key: jti})
+	}
+	return true, nil
+}
+
+func (s *KVStore) UseNonce(record NonceRecord, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.sweepExpired(kvGroupNonces, now); err != nil {
+		return err
+	}
+	key := nonceMapKey(record.ClientID, record.NonceHash)
+	existing := NonceRecord{}
+	err := s.getJSON(kvGroupNonces, key, &existing)
+	if err == nil && !now.After(existing.ExpiresAt) {
+		return ErrNonceReplay
+	}
+	if err != nil && !errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+		return err
+	}
+	return s.saveJSON(kvGroupNonces, key, record)
+}
+
+func (s *KVStore) SaveBackchannelRequest(record BackchannelAuthRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveJSON(kvGroupBackchannel, record.IDHash, record)
+}
+
+func (s *KVStore) UpdateBackchannelPoll(idHash string, polledAt time.Time, interval int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := BackchannelAuthRequest{}
+	if err := s.getJSON(kvGroupBackchannel, idHash, &record); err != nil {
+		if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+			return ErrBackchannelNotFound
+		}
+		return err
+	}
+	if record.Status != backchannelStatusPending {
+		return nil
+	}
+	record.LastPolledAt = polledAt
+	record.Interval = interval
+	return s.saveJSON(kvGroupBackchannel, idHash, record)
+}
+
+func (s *KVStore) SetBackchannelDecisionToken(idHash, tokenHash, sessionHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := BackchannelAuthRequest{}
+	if err := s.getJSON(kvGroupBackchannel, idHash, &record); err != nil {
+		if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+			return ErrBackchannelNotFound
+		}
+		return err
+	}
+	if record.Status != backchannelStatusPending {
+		return nil
+	}
+	record.DecisionToken = tokenHash
+	record.DecisionSession = sessionHash
+	return s.saveJSON(kvGroupBackchannel, idHash, record)
+}
+
+func (s *KVStore) GetBackchannelRequest(idHash string, now time.Time) (BackchannelAuthRequest, error) {
+	record := BackchannelAuthRequest{}
+	err := s.getJSON(kvGroupBackchannel, idHash, &record)
+	if err != nil {
+		if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+			return BackchannelAuthRequest{}, ErrBackchannelNotFound
+		}
+		return BackchannelAuthRequest{}, err
+	}
+	if now.After(record.ExpiresAt) {
+		return BackchannelAuthRequest{}, ErrBackchannelExpired
+	}
+	return record, nil
+}
+
+func (s *KVStore) ListBackchannelRequests(userID string, now time.Time) []BackchannelAuthRequest {
+	rows, err := s.listJSON(kvGroupBackchannel)
+	if err != nil {
+		return nil
+	}
+	out := make([]BackchannelAuthRequest, 0)
+	for _, raw := range rows {
+		record := BackchannelAuthRequest{}
+		if err = json.Unmarshal([]byte(raw), &record); err != nil {
+			continue
+		}
+		if now.After(record.ExpiresAt) {
+			_ = s.operator.Del(context.Background(), answerplugin.KVParams{Group: kvGroupBackchannel, Key: record.IDHash})
+			continue
+		}
+		if record.UserID == userID && record.Status == backchannelStatusPending {
+			out = append(out, record)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out
+}
+
+func (s *KVStore) DeleteBackchannelRequest(idHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := BackchannelAuthRequest{}
+	if err := s.getJSON(kvGroupBackchannel, idHash, &record); err != nil {
+		if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+			return ErrBackchannelNotFound
+		}
+		return err
+	}
+	return s.operator.Del(context.Background(), answerplugin.KVParams{Group: kvGroupBackchannel, Key: idHash})
+}
+
 func (s *KVStore) SaveRefreshToken(record RefreshTokenRecord) error {
-	return s.saveJSON(kvGroupRefreshTokens, record.TokenHash, record)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.sweepRefreshTokens(time.Now().UTC()); err != nil {
+		return err
+	}
+	if err := s.saveJSON(kvGroupRefreshTokens, record.TokenHash, record); err != nil {
+		return err
+	}
+	return s.indexRefreshToken(record)
 }
 
 func (s *KVStore) GetRefreshToken(rawToken string, now time.Time) (RefreshTokenRecord, error) {
-	tokenHash := sha256Hex(rawToken)
+	return s.GetRefreshTokenByHash(sha256Hex(rawToken), now)
+}
+
+func (s *KVStore) GetRefreshTokenByHash(tokenHash string, now time.Time) (RefreshTokenRecord, error) {
 	record := RefreshTokenRecord{}
 	err := s.getJSON(kvGroupRefreshTokens, tokenHash, &record)
 	if err != nil {
@@ -221,7 +594,7 @@ func (s *KVStore) GetRefreshToken(rawToken string, now time.Time) (RefreshTokenR
 		return RefreshTokenRecord{}, err
 	}
 	if record.RevokedAt != nil {
-		return RefreshTokenRecord{}, ErrRefreshTokenRevoked
+		return record, ErrRefreshTokenRevoked
 	}
 	if now.After(record.ExpiresAt) {
 		return RefreshTokenRecord{}, ErrRefreshTokenExpired
@@ -266,10 +639,109 @@ func (s *KVStore) RotateRefreshToken(oldRawToken string, newRecord RefreshTokenR
 	}
 	revoked := now.UTC()
 	oldRecord.RevokedAt = &revoked
+	oldRecord.ReplacedBy = newRecord.TokenHash
 	if err = s.saveJSON(kvGroupRefreshTokens, oldHash, oldRecord); err != nil {
 		return err
 	}
-	return s.saveJSON(kvGroupRefreshTokens, newRecord.TokenHash, newRecord)
+	if err = s.saveJSON(kvGroupRefreshTokens, newRecord.TokenHash, newRecord); err != nil {
+		return err
+	}
+	return s.indexRefreshToken(newRecord)
+}
+
+func (s *KVStore) RevokeRefreshTokenFamily(familyID string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	family := kvRefreshFamily{}
+	err := s.getJSON(kvGroupRefreshFamily, familyID, &family)
+	if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+		return s.revokeUnindexedRefreshFamily(familyID, now)
+	}
+	if err != nil {
+		return err
+	}
+	revoked := now.UTC()
+	return s.operator.Tx(context.Background(), func(ctx context.Context, tx *answerplugin.KVOperator) error {
+		for _, tokenHash := range family.TokenHashes {
+			record := RefreshTokenRecord{}
+			if err := kvGetJSON(ctx, tx, kvGroupRefreshTokens, tokenHash, &record); err != nil {
+				if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+					continue
+				}
+				return err
+			}
+			if record.RevokedAt != nil {
+				continue
+			}
+			record.RevokedAt = &revoked
+			if err := kvSaveJSON(ctx, tx, kvGroupRefreshTokens, tokenHash, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *KVStore) indexRefreshToken(record RefreshTokenRecord) error {
+	if record.FamilyID == "" {
+		return nil
+	}
+	family := kvRefreshFamily{FamilyID: record.FamilyID}
+	err := s.getJSON(kvGroupRefreshFamily, record.FamilyID, &family)
+	if err != nil && !errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+		return err
+	}
+	if !containsValue(family.TokenHashes, record.TokenHash) {
+		family.TokenHashes = append(family.TokenHashes, record.TokenHash)
+	}
+	if record.ExpiresAt.After(family.ExpiresAt) {
+		family.ExpiresAt = record.ExpiresAt
+	}
+	return s.saveJSON(kvGroupRefreshFamily, record.FamilyID, family)
+}
+
+func (s *KVStore) revokeUnindexedRefreshFamily(familyID string, now time.Time) error {
+	rows, err := s.listJSON(kvGroupRefreshTokens)
+	if err != nil {
+		return err
+	}
+	revoked := now.UTC()
+	for key, raw := range rows {
+		record := RefreshTokenRecord{}
+		if err = json.Unmarshal([]byte(raw), &record); err != nil {
+			continue
+		}
+		if record.FamilyID != familyID || record.RevokedAt != nil {
+			continue
+		}
+		record.RevokedAt = &revoked
+		if err = s.saveJSON(kvGroupRefreshTokens, key, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *KVStore) RecordSecurityEvent(event SecurityEvent) error {
+	return s.saveJSON(kvGroupEvents, event.ID, event)
+}
+
+func (s *KVStore) ListSecurityEvents() []SecurityEvent {
+	rows, err := s.listJSON(kvGroupEvents)
+	if err != nil {
+		return nil
+	}
+	out := make([]SecurityEvent, 0, len(rows))
+	for _, raw := range rows {
+		event := SecurityEvent{}
+		if err = json.Unmarshal([]byte(raw), &event); err == nil {
+			out = append(out, event)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	return out
 }
 
 func (s *KVStore) SaveConsent(record ConsentRecord) error {
@@ -294,26 +766,167 @@ func (s *KVStore) GetConsent(clientID, userID string) (ConsentRecord, error) {
 	return record, nil
 }
 
+func (s *KVStore) ListConsents(userID string) []ConsentRecord {
+	rows, err := s.listJSON(kvGroupConsents)
+	if err != nil {
+		return nil
+	}
+	out := make([]ConsentRecord, 0)
+	for _, raw := range rows {
+		record := ConsentRecord{}
+		if err = json.Unmarshal([]byte(raw), &record); err == nil && record.UserID == userID {
+			out = append(out, record)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].UpdatedAt.After(out[j].UpdatedAt)
+	})
+	return out
+}
+
+func (s *KVStore) SaveKnownUser(record KnownUserRecord) error {
+	record.UpdatedAt = time.Now().UTC()
+	if err := s.saveJSON(kvGroupKnownUsers, record.UserID, record); err != nil {
+		return err
+	}
+	if record.Email == "" {
+		return nil
+	}
+	return s.saveJSON(kvGroupKnownUsers, knownUserEmailKey(record.Email), record)
+}
+
+func (s *KVStore) FindKnownUser(hint string) (KnownUserRecord, error) {
+	record := KnownUserRecord{}
+	err := s.getJSON(kvGroupKnownUsers, hint, &record)
+	if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+		err = s.getJSON(kvGroupKnownUsers, knownUserEmailKey(hint), &record)
+	}
+	if err != nil {
+		if errors.Is(err, answerplugin.ErrKVKeyNotFound) {
+			return KnownUserRecord{}, ErrKnownUserNotFound
+		}
+		return KnownUserRecord{}, err
+	}
+	return record, nil
+}
+
 func (s *KVStore) saveJSON(group, key string, value any) error {
+	return kvSaveJSON(context.Background(), s.operator, group, key, value)
+}
+
+func (s *KVStore) getJSON(group, key string, out any) error {
+	return kvGetJSON(context.Background(), s.operator, group, key, out)
+}
+
+func kvSaveJSON(ctx context.Context, operator *answerplugin.KVOperator, group, key string, value any) error {
 	payload, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
-	return s.operator.Set(context.Background(), answerplugin.KVParams{
+	return operator.Set(ctx, answerplugin.KVParams{
 		Group: group,
 		Key:   key,
 		Value: string(payload),
 	})
 }
 
-func (s *KVStore) getJSON(group, key string, out any) error {
-	raw, err := s.operator.Get(context.Background(), answerplugin.KVParams{Group: group, Key: key})
+func kvGetJSON(ctx context.Context, operator *answerplugin.KVOperator, group, key string, out any) error {
+	raw, err := operator.Get(ctx, answerplugin.KVParams{Group: group, Key: key})
 	if err != nil {
 		return err
 	}
 	return json.Unmarshal([]byte(raw), out)
 }
 
+func (s *KVStore) sweepExpired(group string, now time.Time) error {
+	if now.Sub(s.sweptAt[group]) < kvSweepInterval {
+		return nil
+	}
+	s.sweptAt[group] = now
+	rows, err := s.listJSON(group)
+	if err != nil {
+		return err
+	}
+	for key, raw := range rows {
+		record := struct{ ExpiresAt time.Time }{}
+		if err = json.Unmarshal([]byte(raw), &record); err != nil || record.ExpiresAt.IsZero() || !now.After(record.ExpiresAt) {
+			continue
+		}
+		if err = s.operator.Del(context.Background(), answerplugin.KVParams{Group: group, Key: key}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *KVStore) sweepLoginSessions(now time.Time) error {
+	if now.Sub(s.sweptAt[kvGroupLoginSessions]) < kvSweepInterval {
+		return nil
+	}
+	s.sweptAt[kvGroupLoginSessions] = now
+	rows, err := s.listJSON(kvGroupLoginSessions)
+	if err != nil {
+		return err
+	}
+	for key, raw := range rows {
+		record := LoginSessionRecord{}
+		if err = json.Unmarshal([]byte(raw), &record); err != nil || now.Sub(record.AuthTime) <= kvLoginSessionTTL {
+			continue
+		}
+		if err = s.operator.Del(context.Background(), answerplugin.KVParams{Group: kvGroupLoginSessions, Key: key}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *KVStore) sweepRefreshTokens(now time.Time) error {
+	if now.Sub(s.sweptAt[kvGroupRefreshTokens]) < kvSweepInterval {
+		return nil
+	}
+	s.sweptAt[kvGroupRefreshTokens] = now
+	families, err := s.listJSON(kvGroupRefreshFamily)
+	if err != nil {
+		return err
+	}
+	familyExpiry := make(map[string]time.Time, len(families))
+	for key, raw := range families {
+		family := kvRefreshFamily{}
+		if err = json.Unmarshal([]byte(raw), &family); err == nil {
+			familyExpiry[key] = family.ExpiresAt
+		}
+	}
+	rows, err := s.listJSON(kvGroupRefreshTokens)
+	if err != nil {
+		return err
+	}
+	for key, raw := range rows {
+		record := RefreshTokenRecord{}
+		if err = json.Unmarshal([]byte(raw), &record); err != nil {
+			continue
+		}
+		expiresAt, indexed := familyExpiry[record.FamilyID]
+		if !indexed {
+			expiresAt = record.ExpiresAt
+		}
+		if !now.After(expiresAt) {
+			continue
+		}
+		if err = s.operator.Del(context.Background(), answerplugin.KVParams{Group: kvGroupRefreshTokens, Key: key}); err != nil {
+			return err
+		}
+	}
+	for key, expiresAt := range familyExpiry {
+		if !now.After(expiresAt) {
+			continue
+		}
+		if err = s.operator.Del(context.Background(), answerplugin.KVParams{Group: kvGroupRefreshFamily, Key: key}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *KVStore) listJSON(group string) (map[string]string, error) {
 	result := make(map[string]string)
 	for page := 1; ; page++ {
@@ -2,14 +2,20 @@ package oidc
 
 import (
 	"encoding/json"
+	"strings"
+	"testing"
 )
 
 type fakeContext struct {
 	query      map[string]string
 	form       map[string]string
+	arrays     map[string][]string
 	headers    map[string]string
+	setHeaders map[string]string
 	statusCode int
 	jsonBody   any
+	dataBody   []byte
+	htmlBody   string
 	redirect   string
 	bindBody   []byte
 }
@@ -21,6 +27,26 @@ func (f *fakeContext) Query(key string) string {
 	return f.query[key]
 }
 
+func (f *fakeContext) QueryArray(key string) []string {
+	if values, ok := f.arrays[key]; ok {
+		return values
+	}
+	if value := f.Query(key); value != "" {
+		return []string{value}
+	}
+	return nil
+}
+
+func (f *fakeContext) PostFormArray(key string) []string {
+	if values, ok := f.arrays[key]; ok {
+		return values
+	}
+	if value := f.PostForm(key); value != "" {
+		return []string{value}
+	}
+	return nil
+}
+
 func (f *fakeContext) PostForm(key string) string {
 	if f.form == nil {
 		return ""
@@ -35,11 +61,34 @@ func (f *fakeContext) Header(key string) string {
 	return f.headers[key]
 }
 
+func (f *fakeContext) SetHeader(key, value string) {
+	if f.setHeaders == nil {
+		f.setHeaders = map[string]string{}
+	}
+	f.setHeaders[key] = value
+}
+
 func (f *fakeContext) JSON(status int, value any) {
 	f.statusCode = status
 	f.jsonBody = value
 }
 
+func (f *fakeContext) Data(status int, contentType string, body []byte) {
+	f.statusCode = status
+	f.dataBody = body
+	if strings.HasPrefix(contentType, "application/json") {
+		decoded := map[string]any{}
+		if err := json.Unmarshal(body, &decoded); err == nil {
+			f.jsonBody = decoded
+		}
+	}
+}
+
+func (f *fakeContext) HTML(status int, body string) {
+	f.statusCode = status
+	f.htmlBody = body
+}
+
 func (f *fakeContext) Redirect(status int, location string) {
 	f.statusCode = status
 	f.redirect = location
@@ -60,3 +109,12 @@ func mustOAuthError(value any) OAuthError {
 	errBody, _ := value.(OAuthError)
 	return errBody
 }
+
+func newTestTokenService(t *testing.T, config Config) *TokenService {
+	t.Helper()
+	ks, err := NewKeyService("")
+	if err != nil {
+		t.Fatalf("new key service: %v", err)
+	}
+	return NewTokenService(config, ks)
+}
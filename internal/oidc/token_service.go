@@ -10,42 +10,84 @@ import (
 
 var ErrInvalidToken = errors.New("invalid token")
 
+const authorizationResponseTTL = 10 * time.Minute
+
+const accessTokenJWTType = "at+jwt"
+
 type TokenClaims map[string]any
 
+type AccessTokenDenylist interface {
+	IsAccessTokenDenied(jti string, now time.Time) (bool, error)
+}
+
 type TokenService struct {
-	issuer       string
-	accessTTL    time.Duration
-	idTTL        time.Duration
-	refreshTTL   time.Duration
-	keyService   *KeyService
-	nowFn        func() time.Time
-	defaultScope []string
+	issuer        string
+	accessTTL     time.Duration
+	idTTL         time.Duration
+	refreshTTL    time.Duration
+	refreshMax    time.Duration
+	accessCap     time.Duration
+	idCap         time.Duration
+	refreshCap    time.Duration
+	refreshMaxCap time.Duration
+	reuseGrace    time.Duration
+	profile       string
+	keyService    *KeyService
+	denylist      AccessTokenDenylist
+	nowFn         func() time.Time
+	defaultScope  []string
 }
 
 func NewTokenService(config Config, keyService *KeyService) *TokenService {
 	normalized := config.normalize()
 	return &TokenService{
-		issuer:       normalized.Issuer,
-		accessTTL:    normalized.AccessTokenTTL,
-		idTTL:        normalized.IDTokenTTL,
-		refreshTTL:   normalized.RefreshTokenTTL,
-		keyService:   keyService,
-		nowFn:        func() time.Time { return time.Now().UTC() },
-		defaultScope: append([]string(nil), normalized.DefaultScopes...),
+		issuer:        normalized.issuerURL(),
+		accessTTL:     normalized.AccessTokenTTL,
+		idTTL:         normalized.IDTokenTTL,
+		refreshTTL:    normalized.RefreshTokenTTL,
+		refreshMax:    normalized.RefreshTokenMaxLifetime,
+		accessCap:     normalized.MaxClientAccessTTL,
+		idCap:         normalized.MaxClientIDTTL,
+		refreshCap:    normalized.MaxClientRefreshTTL,
+		refreshMaxCap: normalized.MaxClientRefreshMax,
+		reuseGrace:    normalized.RefreshReuseGrace,
+		profile:       normalized.AccessTokenProfile,
+		keyService:    keyService,
+		nowFn:         func() time.Time { return time.Now().UTC() },
+		defaultScope:  append([]string(nil), normalized.DefaultScopes...),
 	}
 }
 
+func (s *TokenService) Issuer() string {
+	return s.issuer
+}
+
+func (s *TokenService) RefreshReuseGrace() time.Duration {
+	return s.reuseGrace
+}
+
+func (s *TokenService) SetAccessTokenDenylist(denylist AccessTokenDenylist) {
+	s.denylist = denylist
+}
+
 func (s *TokenService) IssueAccessToken(claims AccessTokenClaims) (string, int64, error) {
 	now := s.nowFn()
 	if claims.IssuedAt.IsZero() {
 		claims.IssuedAt = now
 	}
 	if claims.ExpiresAt.IsZero() {
-		claims.ExpiresAt = now.Add(s.accessTTL)
+		claims.ExpiresAt = now.Add(clientLifetime(claims.Lifetime, s.accessTTL, s.accessCap))
 	}
 	if claims.Issuer == "" {
 		claims.Issuer = s.issuer
 	}
+	if claims.JTI == "" {
+		jti, err := randomURLSafe(16)
+		if err != nil {
+			return "", 0, err
+		}
+		claims.JTI = jti
+	}
 	if len(claims.Scope) == 0 {
 		claims.Scope = append([]string(nil), s.defaultScope...)
 	}
@@ -53,15 +95,35 @@ func (s *TokenService) IssueAccessToken(claims AccessTokenClaims) (string, int64
 	jwtClaims := jwt.MapClaims{
 		"iss":   claims.Issuer,
 		"sub":   claims.Subject,
-		"aud":   claims.Audience,
+		"aud":   audienceClaim(claims.Resources, claims.Audience),
 		"scope": strings.Join(claims.Scope, " "),
 		"iat":   claims.IssuedAt.Unix(),
 		"exp":   claims.ExpiresAt.Unix(),
-		"typ":   "Bearer",
-		"use":   "access_token",
+		"jti":   claims.JTI,
+	}
+	if claims.ClientID != "" {
+		jwtClaims["client_id"] = claims.ClientID
+	}
+	if len(claims.AuthorizationDetails) > 0 {
+		jwtClaims["authorization_details"] = claims.AuthorizationDetails
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwtClaims)
 	token.Header["kid"] = s.keyService.KID()
+	if s.profile == AccessTokenProfileRFC9068 {
+		token.Header["typ"] = accessTokenJWTType
+		if !claims.AuthTime.IsZero() {
+			jwtClaims["auth_time"] = claims.AuthTime.Unix()
+		}
+		if len(claims.Roles) > 0 {
+			jwtClaims["roles"] = claims.Roles
+		}
+		if len(claims.Groups) > 0 {
+			jwtClaims["groups"] = claims.Groups
+		}
+	} else {
+		jwtClaims["typ"] = "Bearer"
+		jwtClaims["use"] = "access_token"
+	}
 	signed, err := token.SignedString(s.keyService.PrivateKey())
 	if err != nil {
 		return "", 0, err
@@ -75,7 +137,7 @@ func (s *TokenService) IssueIDToken(claims IDTokenClaims) (string, int64, error)
 		claims.IssuedAt = now
 	}
 	if claims.ExpiresAt.IsZero() {
-		claims.ExpiresAt = now.Add(s.idTTL)
+		claims.ExpiresAt = now.Add(clientLifetime(claims.Lifetime, s.idTTL, s.idCap))
 	}
 	if claims.Issuer == "" {
 		claims.Issuer = s.issuer
@@ -88,11 +150,19 @@ func (s *TokenService) IssueIDToken(claims IDTokenClaims) (string, int64, error)
 		"iss":       claims.Issuer,
 		"sub":       claims.Subject,
 		"aud":       claims.Audience,
-		"nonce":     claims.Nonce,
 		"iat":       claims.IssuedAt.Unix(),
 		"exp":       claims.ExpiresAt.Unix(),
 		"auth_time": claims.AuthTime.Unix(),
 	}
+	if claims.Nonce != "" {
+		jwtClaims["nonce"] = claims.Nonce
+	}
+	if claims.ACR != "" {
+		jwtClaims["acr"] = claims.ACR
+	}
+	if len(claims.AMR) > 0 {
+		jwtClaims["amr"] = claims.AMR
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwtClaims)
 	token.Header["kid"] = s.keyService.KID()
 	signed, err := token.SignedString(s.keyService.PrivateKey())
@@ -102,12 +172,80 @@ func (s *TokenService) IssueIDToken(claims IDTokenClaims) (string, int64, error)
 	return signed, int64(claims.ExpiresAt.Sub(now).Seconds()), nil
 }
 
-func (s *TokenService) NewRefreshToken() (raw string, hash string, expiresAt time.Time, err error) {
+func (s *TokenService) IssueAuthorizationResponse(audience string, params map[string]string) (string, error) {
+	now := s.nowFn()
+	jwtClaims := jwt.MapClaims{
+		"iss": s.issuer,
+		"aud": audience,
+		"exp": now.Add(authorizationResponseTTL).Unix(),
+	}
+	for key, value := range params {
+		jwtClaims[key] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwtClaims)
+	token.Header["kid"] = s.keyService.KID()
+	return token.SignedString(s.keyService.PrivateKey())
+}
+
+func (s *TokenService) NewOpaqueAccessToken(lifetime time.Duration) (raw string, hash string, expiresAt time.Time, err error) {
 	raw, err = randomURLSafe(32)
 	if err != nil {
 		return "", "", time.Time{}, err
 	}
-	return raw, sha256Hex(raw), s.nowFn().Add(s.refreshTTL), nil
+	return raw, sha256Hex(raw), s.nowFn().Add(clientLifetime(lifetime, s.accessTTL, s.accessCap)), nil
+}
+
+func (s *TokenService) NewRefreshToken(client OIDCClient, maxExpiresAt time.Time) (string, RefreshTokenRecord, error) {
+	raw, err := randomURLSafe(32)
+	if err != nil {
+		return "", RefreshTokenRecord{}, err
+	}
+	now := s.nowFn()
+	idleTTL := clientLifetime(time.Duration(client.RefreshTokenTTLSeconds)*time.Second, s.refreshTTL, s.refreshCap)
+	maxLifetime := clientLifetime(time.Duration(client.RefreshTokenMaxLifetimeSeconds)*time.Second, s.refreshMax, s.refreshMaxCap)
+	if maxExpiresAt.IsZero() && maxLifetime > 0 {
+		maxExpiresAt = now.Add(maxLifetime)
+	}
+	expiresAt := now.Add(idleTTL)
+	if !maxExpiresAt.IsZero() && maxExpiresAt.Before(expiresAt) {
+		expiresAt = maxExpiresAt
+	}
+	return raw, RefreshTokenRecord{
+		TokenHash:    sha256Hex(raw),
+		ClientID:     client.ID,
+		ExpiresAt:    expiresAt,
+		MaxExpiresAt: maxExpiresAt,
+		CreatedAt:    now,
+	}, nil
+}
+
+func (s *TokenService) ParseIDTokenHint(raw string) (string, error) {
+	token, err := jwt.ParseWithClaims(raw, jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return s.keyService.PublicKey(), nil
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithoutClaimsValidation())
+	if err != nil || !token.Valid {
+		return "", ErrInvalidToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	if issuer, _ := claims["iss"].(string); issuer != s.issuer {
+		return "", ErrInvalidToken
+	}
+	if isAccessTokenJWT(token.Header, claims) {
+		return "", ErrInvalidToken
+	}
+	for _, key := range []string{"response", "code", "error"} {
+		if _, ok := claims[key]; ok {
+			return "", ErrInvalidToken
+		}
+	}
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return "", ErrInvalidToken
+	}
+	return subject, nil
 }
 
 func (s *TokenService) ParseAndValidateAccessToken(raw string) (TokenClaims, error) {
@@ -124,16 +262,28 @@ func (s *TokenService) ParseAndValidateAccessToken(raw string) (TokenClaims, err
 	if !ok {
 		return nil, ErrInvalidToken
 	}
-	if use, _ := claims["use"].(string); use != "access_token" {
+	if !isAccessTokenJWT(token.Header, claims) {
 		return nil, ErrInvalidToken
 	}
 	exp, err := claims.GetExpirationTime()
 	if err != nil || exp == nil || time.Now().UTC().After(exp.Time) {
 		return nil, ErrInvalidToken
 	}
+	if jti, _ := claims["jti"].(string); jti != "" && s.denylist != nil {
+		denied, err := s.denylist.IsAccessTokenDenied(jti, s.nowFn())
+		if err != nil || denied {
+			return nil, ErrInvalidToken
+		}
+	}
 	result := make(TokenClaims, len(claims))
 	for key, value := range claims {
 		result[key] = value
 	}
 	return result, nil
 }
+
+func isAccessTokenJWT(header map[string]any, claims jwt.MapClaims) bool {
+	typ, _ := header["typ"].(string)
+	use, _ := claims["use"].(string)
+	return strings.TrimPrefix(strings.ToLower(typ), "application/") == accessTokenJWTType || use == "access_token"
+}
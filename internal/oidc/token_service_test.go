@@ -33,6 +33,118 @@ func TestIssueAndVerifyAccessToken(t *testing.T) {
 	}
 }
 
+func TestAccessTokenProfiles(t *testing.T) {
+	ks, err := NewKeyService("")
+	if err != nil {
+		t.Fatalf("new key service: %v", err)
+	}
+	legacyConfig := DefaultConfig()
+	legacyConfig.Issuer = "https://answer.example.com"
+	legacy := NewTokenService(legacyConfig, ks)
+	rfcConfig := legacyConfig
+	rfcConfig.AccessTokenProfile = AccessTokenProfileRFC9068
+	rfc := NewTokenService(rfcConfig, ks)
+
+	authTime := time.Now().UTC().Add(-time.Minute)
+	claims := AccessTokenClaims{
+		Audience: "client-1",
+		ClientID: "client-1",
+		Subject:  "user-1",
+		Scope:    []string{"openid"},
+		AuthTime: authTime,
+		Roles:    []string{"admin"},
+		Groups:   []string{"staff"},
+	}
+	legacyToken, _, err := legacy.IssueAccessToken(claims)
+	if err != nil {
+		t.Fatalf("issue legacy token: %v", err)
+	}
+	rfcToken, _, err := rfc.IssueAccessToken(claims)
+	if err != nil {
+		t.Fatalf("issue rfc9068 token: %v", err)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(rfcToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("decode rfc9068 token: %v", err)
+	}
+	if parsed.Header["typ"] != "at+jwt" {
+		t.Fatalf("expected at+jwt header, got %v", parsed.Header["typ"])
+	}
+	rfcClaims := parsed.Claims.(jwt.MapClaims)
+	if _, ok := rfcClaims["use"]; ok {
+		t.Fatalf("rfc9068 token should not carry use claim: %#v", rfcClaims)
+	}
+	if rfcClaims["client_id"] != "client-1" || rfcClaims["jti"] == "" || rfcClaims["auth_time"] != float64(authTime.Unix()) {
+		t.Fatalf("unexpected rfc9068 claims: %#v", rfcClaims)
+	}
+	if roles, _ := rfcClaims["roles"].([]any); len(roles) != 1 || roles[0] != "admin" {
+		t.Fatalf("unexpected roles: %#v", rfcClaims["roles"])
+	}
+	if groups, _ := rfcClaims["groups"].([]any); len(groups) != 1 || groups[0] != "staff" {
+		t.Fatalf("unexpected groups: %#v", rfcClaims["groups"])
+	}
+
+	parsed, _, err = jwt.NewParser().ParseUnverified(legacyToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("decode legacy token: %v", err)
+	}
+	legacyClaims := parsed.Claims.(jwt.MapClaims)
+	if parsed.Header["typ"] == "at+jwt" || legacyClaims["use"] != "access_token" || legacyClaims["typ"] != "Bearer" {
+		t.Fatalf("unexpected legacy token shape: %#v %#v", parsed.Header, legacyClaims)
+	}
+	if _, ok := legacyClaims["roles"]; ok {
+		t.Fatalf("legacy token should not carry roles: %#v", legacyClaims)
+	}
+
+	for _, ts := range []*TokenService{legacy, rfc} {
+		for _, token := range []string{legacyToken, rfcToken} {
+			if _, err := ts.ParseAndValidateAccessToken(token); err != nil {
+				t.Fatalf("expected both token shapes to validate: %v", err)
+			}
+		}
+	}
+
+	idToken, _, err := rfc.IssueIDToken(IDTokenClaims{Audience: "client-1", Subject: "user-1"})
+	if err != nil {
+		t.Fatalf("issue id token: %v", err)
+	}
+	if _, err := rfc.ParseAndValidateAccessToken(idToken); err == nil {
+		t.Fatal("expected id token to be rejected as access token")
+	}
+}
+
+func TestClientTokenLifetimes(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxClientAccessTTL = time.Hour
+	ts := newTestTokenService(t, config)
+
+	_, expiresIn, err := ts.IssueAccessToken(AccessTokenClaims{Audience: "dashboard", Subject: "u_1"})
+	if err != nil || expiresIn != int64(config.AccessTokenTTL/time.Second) {
+		t.Fatalf("expected global access token ttl, got %d err=%v", expiresIn, err)
+	}
+	_, expiresIn, err = ts.IssueAccessToken(AccessTokenClaims{Audience: "dashboard", Subject: "u_1", Lifetime: time.Hour})
+	if err != nil || expiresIn != 3600 {
+		t.Fatalf("expected client access token ttl, got %d err=%v", expiresIn, err)
+	}
+	_, expiresIn, err = ts.IssueAccessToken(AccessTokenClaims{Audience: "dashboard", Subject: "u_1", Lifetime: 2 * time.Hour})
+	if err != nil || expiresIn != 3600 {
+		t.Fatalf("client override must be capped by the global maximum, got %d err=%v", expiresIn, err)
+	}
+	_, expiresIn, err = ts.IssueIDToken(IDTokenClaims{Audience: "partner", Subject: "u_1", Lifetime: 5 * time.Minute})
+	if err != nil || expiresIn != 300 {
+		t.Fatalf("expected client id token ttl, got %d err=%v", expiresIn, err)
+	}
+	_, _, expiresAt, err := ts.NewOpaqueAccessToken(5 * time.Minute)
+	if err != nil || expiresAt.Sub(time.Now()) > 5*time.Minute {
+		t.Fatalf("opaque token must honor the client ttl, expires at %v err=%v", expiresAt, err)
+	}
+	_, record, err := ts.NewRefreshToken(OIDCClient{ID: "partner", RefreshTokenTTLSeconds: int64(2 * 365 * 24 * time.Hour / time.Second)}, time.Time{})
+	if err != nil || record.ExpiresAt.Sub(record.CreatedAt) > config.MaxClientRefreshTTL {
+		t.Fatalf("refresh override must be capped, got %v err=%v", record.ExpiresAt, err)
+	}
+}
+
 func TestIssueAndVerifyIDToken(t *testing.T) {
 	config := DefaultConfig()
 	config.Issuer = "https://answer.example.com"
@@ -66,6 +178,44 @@ func TestIssueAndVerifyIDToken(t *testing.T) {
 	}
 }
 
+func TestIDTokenHintRejectsOtherTokens(t *testing.T) {
+	config := DefaultConfig()
+	config.Issuer = "https://answer.example.com"
+	ts := newTestTokenService(t, config)
+
+	expired, _, err := ts.IssueIDToken(IDTokenClaims{Audience: "client-1", Subject: "user-1", ExpiresAt: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("issue id token: %v", err)
+	}
+	if subject, err := ts.ParseIDTokenHint(expired); err != nil || subject != "user-1" {
+		t.Fatalf("expired id token must still be accepted as a hint: %q %v", subject, err)
+	}
+
+	legacy, _, err := ts.IssueAccessToken(AccessTokenClaims{Audience: "client-1", Subject: "user-1"})
+	if err != nil {
+		t.Fatalf("issue access token: %v", err)
+	}
+	config.AccessTokenProfile = AccessTokenProfileRFC9068
+	profiled, _, err := NewTokenService(config, ts.keyService).IssueAccessToken(AccessTokenClaims{Audience: "client-1", Subject: "user-1"})
+	if err != nil {
+		t.Fatalf("issue access token: %v", err)
+	}
+	jarm, err := ts.IssueAuthorizationResponse("client-1", map[string]string{"code": "abc", "state": "s", "sub": "user-1"})
+	if err != nil {
+		t.Fatalf("issue authorization response: %v", err)
+	}
+	config.Issuer = "https://other.example.com"
+	foreign, _, err := NewTokenService(config, ts.keyService).IssueIDToken(IDTokenClaims{Audience: "client-1", Subject: "user-1"})
+	if err != nil {
+		t.Fatalf("issue id token: %v", err)
+	}
+	for name, hint := range map[string]string{"legacy access token": legacy, "rfc9068 access token": profiled, "jarm response": jarm, "foreign issuer": foreign} {
+		if _, err := ts.ParseIDTokenHint(hint); err == nil {
+			t.Fatalf("%s must not be accepted as id_token_hint", name)
+		}
+	}
+}
+
 func TestJWKSContainsActiveKey(t *testing.T) {
 	ks, err := NewKeyService("")
 	if err != nil {
@@ -36,6 +36,16 @@ func ExtractAnswerUserFromContext(ctx *gin.Context) (UserProfile, bool) {
 		profile.Username = readStructStringField(value, "DisplayName")
 	}
 	profile.Email = readStructStringField(value, "Mail")
+	profile.SessionID = readStructStringField(value, "VisitToken")
+	if readStructStringField(value, "ExternalID") != "" {
+		profile.AuthMethods = []string{"fed"}
+	} else {
+		profile.AuthMethods = []string{"pwd"}
+	}
+	if role := answerRoleName(readStructIntField(value, "RoleID")); role != "" {
+		profile.Roles = []string{role}
+	}
+	profile.Groups = readStructStringSliceField(value, "Groups")
 	profile.Name = readStructStringField(value, "DisplayName")
 	if profile.Name == "" {
 		profile.Name = profile.Username
@@ -58,3 +68,40 @@ func readStructStringField(value reflect.Value, fieldName string) string {
 	}
 	return strings.TrimSpace(field.String())
 }
+
+func readStructIntField(value reflect.Value, fieldName string) int64 {
+	field := value.FieldByName(fieldName)
+	if !field.IsValid() || !field.CanInt() {
+		return 0
+	}
+	return field.Int()
+}
+
+func readStructStringSliceField(value reflect.Value, fieldName string) []string {
+	field := value.FieldByName(fieldName)
+	if !field.IsValid() || field.Kind() != reflect.Slice || field.Type().Elem().Kind() != reflect.String {
+		return nil
+	}
+	out := make([]string, 0, field.Len())
+	for i := 0; i < field.Len(); i++ {
+		if item := strings.TrimSpace(field.Index(i).String()); item != "" {
+			out = append(out, item)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func answerRoleName(roleID int64) string {
+	switch roleID {
+	case 1:
+		return "user"
+	case 2:
+		return "admin"
+	case 3:
+		return "moderator"
+	}
+	return ""
+}
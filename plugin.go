@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 
 	answerplugin "github.com/apache/answer/plugin"
 	"github.com/gin-gonic/gin"
+	"github.com/segmentfault/pacman/log"
 	oidci18n "github.com/wchiways/answer_connect/i18n"
 	oidc "github.com/wchiways/answer_connect/internal/oidc"
 )
@@ -26,15 +28,19 @@ type OIDCProviderPlugin struct {
 	keyService   *oidc.KeyService
 	tokenService *oidc.TokenService
 
-	authorizeHandler *oidc.AuthorizeHandler
-	tokenHandler     *oidc.TokenHandler
-	metadataHandler  *oidc.MetadataHandler
-	userinfoHandler  *oidc.UserInfoHandler
-	revokeHandler    *oidc.RevokeHandler
-	adminHandler     *oidc.AdminClientHandler
-
-	usersMu sync.RWMutex
-	users   map[string]oidc.UserProfile
+	authorizeHandler     *oidc.AuthorizeHandler
+	tokenHandler         *oidc.TokenHandler
+	metadataHandler      *oidc.MetadataHandler
+	userinfoHandler      *oidc.UserInfoHandler
+	revokeHandler        *oidc.RevokeHandler
+	introspectHandler    *oidc.IntrospectHandler
+	adminHandler         *oidc.AdminClientHandler
+	adminEventHandler    *oidc.AdminEventHandler
+	connectedAppsHandler *oidc.ConnectedAppsHandler
+	adminResourceHandler *oidc.AdminResourceHandler
+	adminDetailHandler   *oidc.AdminDetailTypeHandler
+	backchannelHandler   *oidc.BackchannelHandler
+	answerUsers          *answerUserService
 }
 
 func init() {
@@ -43,10 +49,9 @@ func init() {
 }
 
 func NewOIDCProviderPlugin() *OIDCProviderPlugin {
-	config := oidc.DefaultConfig().WithFallbackIssuer(answerplugin.SiteURL())
+	config := oidc.DefaultConfig().WithSiteURL(answerplugin.SiteURL())
 	instance := &OIDCProviderPlugin{
 		config: config,
-		users:  make(map[string]oidc.UserProfile),
 	}
 	instance.rebuildServices()
 	return instance
@@ -76,7 +81,7 @@ func (p *OIDCProviderPlugin) ConfigReceiver(configBytes []byte) error {
 	if err != nil {
 		return err
 	}
-	next = next.WithFallbackIssuer(answerplugin.SiteURL())
+	next = next.WithSiteURL(answerplugin.SiteURL())
 	p.config = next
 	if err = p.rebuildServices(); err != nil {
 		return err
@@ -88,34 +93,36 @@ func (p *OIDCProviderPlugin) RegisterUnAuthRouter(r *gin.RouterGroup) {
 	if r == nil {
 		return
 	}
-	p.mu.RLock()
+	p.mu.Lock()
+	if prefix := strings.TrimRight(r.BasePath(), "/"); prefix != p.config.APIPrefix {
+		previous := p.config
+		p.config = p.config.WithAPIPrefix(prefix)
+		if err := p.rebuildServices(); err != nil {
+			log.Errorf("oidc provider: rebuild services for api prefix %q: %v", prefix, err)
+			p.config = previous
+		}
+	}
 	basePath := p.config.BasePath
-	p.mu.RUnlock()
+	p.mu.Unlock()
 
 	group := r.Group(basePath)
-	group.GET("/.well-known/openid-configuration", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
-		handler := p.currentMetadataHandler()
-		if handler == nil {
-			writeServiceUnavailable(ctx, "discovery")
-			return
-		}
-		handler.HandleDiscovery(ctx)
-	}))
-	group.GET("/.well-known/jwks.json", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
-		handler := p.currentMetadataHandler()
+	p.registerWellKnownRoutes(group)
+	p.registerRootWellKnownRoutes(r)
+	group.GET("/authorize", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentAuthorizeHandler()
 		if handler == nil {
-			writeServiceUnavailable(ctx, "jwks")
+			writeServiceUnavailable(ctx, "authorize")
 			return
 		}
-		handler.HandleJWKS(ctx)
+		handler.Handle(ctx)
 	}))
-	group.GET("/authorize", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+	group.POST("/authorize/consent", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
 		handler := p.currentAuthorizeHandler()
 		if handler == nil {
-			writeServiceUnavailable(ctx, "authorize")
+			writeServiceUnavailable(ctx, "authorize_consent")
 			return
 		}
-		handler.Handle(ctx)
+		handler.HandleConsent(ctx)
 	}))
 	group.POST("/token", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
 		handler := p.currentTokenHandler()
@@ -125,6 +132,14 @@ func (p *OIDCProviderPlugin) RegisterUnAuthRouter(r *gin.RouterGroup) {
 		}
 		handler.Handle(ctx)
 	}))
+	group.POST("/bc-authorize", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentBackchannelHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "backchannel")
+			return
+		}
+		handler.HandleAuthenticate(ctx)
+	}))
 	group.GET("/userinfo", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
 		handler := p.currentUserInfoHandler()
 		if handler == nil {
@@ -149,12 +164,154 @@ func (p *OIDCProviderPlugin) RegisterUnAuthRouter(r *gin.RouterGroup) {
 		}
 		handler.Handle(ctx)
 	}))
+	group.POST("/introspect", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentIntrospectHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "introspect")
+			return
+		}
+		handler.Handle(ctx)
+	}))
+}
+
+func (p *OIDCProviderPlugin) registerWellKnownRoutes(group gin.IRoutes) {
+	group.GET("/.well-known/openid-configuration", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentMetadataHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "discovery")
+			return
+		}
+		handler.HandleDiscovery(ctx)
+	}))
+	group.GET("/.well-known/oauth-authorization-server", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentMetadataHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "discovery")
+			return
+		}
+		handler.HandleAuthorizationServerMetadata(ctx)
+	}))
+	group.GET("/.well-known/webfinger", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentMetadataHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "webfinger")
+			return
+		}
+		handler.HandleWebFinger(ctx)
+	}))
+	group.GET("/.well-known/jwks.json", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentMetadataHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "jwks")
+			return
+		}
+		handler.HandleJWKS(ctx)
+	}))
+}
+
+func (p *OIDCProviderPlugin) registerRootWellKnownRoutes(r *gin.RouterGroup) {
+	root := strings.Repeat("/..", strings.Count(strings.TrimRight(r.BasePath(), "/"), "/"))
+	r.GET(root+"/.well-known/webfinger", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentMetadataHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "webfinger")
+			return
+		}
+		handler.HandleWebFinger(ctx)
+	}))
+	r.GET(root+"/.well-known/oauth-authorization-server", func(ctx *gin.Context) {
+		p.serveIssuerMetadata(ctx, "")
+	})
+	r.GET(root+"/.well-known/oauth-authorization-server/*issuer", func(ctx *gin.Context) {
+		p.serveIssuerMetadata(ctx, ctx.Param("issuer"))
+	})
+
+	p.mu.RLock()
+	config := p.config
+	p.mu.RUnlock()
+	if config.IssuerMode != oidc.IssuerModeRoot {
+		return
+	}
+	issuerPath := currentIssuerPath(config)
+	if issuerPath == strings.TrimRight(r.BasePath(), "/")+config.BasePath {
+		return
+	}
+	r.GET(root+issuerPath+"/.well-known/openid-configuration", func(ctx *gin.Context) {
+		p.mu.RLock()
+		current := p.config
+		p.mu.RUnlock()
+		if current.IssuerMode != oidc.IssuerModeRoot || currentIssuerPath(current) != issuerPath {
+			ctx.Status(http.StatusNotFound)
+			return
+		}
+		p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+			handler := p.currentMetadataHandler()
+			if handler == nil {
+				writeServiceUnavailable(ctx, "discovery")
+				return
+			}
+			handler.HandleDiscovery(ctx)
+		})(ctx)
+	})
+}
+
+func (p *OIDCProviderPlugin) serveIssuerMetadata(ctx *gin.Context, suffix string) {
+	p.mu.RLock()
+	issuerPath := currentIssuerPath(p.config)
+	p.mu.RUnlock()
+	if strings.TrimRight(suffix, "/") != issuerPath {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+	p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentMetadataHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "discovery")
+			return
+		}
+		handler.HandleAuthorizationServerMetadata(ctx)
+	})(ctx)
+}
+
+func currentIssuerPath(config oidc.Config) string {
+	parsed, err := url.Parse(config.IssuerURL())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(parsed.Path, "/")
 }
 
 func (p *OIDCProviderPlugin) RegisterAuthUserRouter(r *gin.RouterGroup) {
 	if r == nil {
 		return
 	}
+	p.mu.RLock()
+	basePath := p.config.BasePath
+	p.mu.RUnlock()
+	r.GET(basePath+"/connected-apps", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentConnectedAppsHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "connected_apps")
+			return
+		}
+		handler.HandleList(ctx)
+	}))
+	r.GET(basePath+"/backchannel", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentBackchannelHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "backchannel_pending")
+			return
+		}
+		handler.HandlePending(ctx)
+	}))
+	r.POST(basePath+"/backchannel", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentBackchannelHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "backchannel_decision")
+			return
+		}
+		handler.HandleDecision(ctx)
+	}))
 }
 
 func (p *OIDCProviderPlugin) RegisterAuthAdminRouter(r *gin.RouterGroup) {
@@ -205,6 +362,64 @@ func (p *OIDCProviderPlugin) RegisterAuthAdminRouter(r *gin.RouterGroup) {
 		}
 		handler.HandleDelete(oidc.WrapGinContext(ctx), strings.TrimSpace(ctx.Param("client_id")))
 	})
+	resources := r.Group(basePath + "/admin/resources")
+	resources.GET("", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentAdminResourceHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "admin_resource_list")
+			return
+		}
+		handler.HandleList(ctx)
+	}))
+	resources.PUT("", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentAdminResourceHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "admin_resource_save")
+			return
+		}
+		handler.HandleSave(ctx)
+	}))
+	resources.DELETE("", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentAdminResourceHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "admin_resource_delete")
+			return
+		}
+		handler.HandleDelete(ctx)
+	}))
+	detailTypes := r.Group(basePath + "/admin/authorization-detail-types")
+	detailTypes.GET("", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentAdminDetailHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "admin_detail_type_list")
+			return
+		}
+		handler.HandleList(ctx)
+	}))
+	detailTypes.PUT("", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentAdminDetailHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "admin_detail_type_save")
+			return
+		}
+		handler.HandleSave(ctx)
+	}))
+	detailTypes.DELETE("", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentAdminDetailHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "admin_detail_type_delete")
+			return
+		}
+		handler.HandleDelete(ctx)
+	}))
+	r.GET(basePath+"/admin/security-events", p.wrapHTTPContext(func(ctx oidc.HTTPContext) {
+		handler := p.currentAdminEventHandler()
+		if handler == nil {
+			writeServiceUnavailable(ctx, "admin_security_events")
+			return
+		}
+		handler.HandleList(ctx)
+	}))
 }
 
 func (p *OIDCProviderPlugin) SetOperator(operator *answerplugin.KVOperator) {
@@ -227,12 +442,21 @@ func (p *OIDCProviderPlugin) rebuildServices() error {
 	}
 	p.keyService = keyService
 	p.tokenService = oidc.NewTokenService(p.config, keyService)
-	p.authorizeHandler = oidc.NewAuthorizeHandler(p.store, p.config, p.resolveCurrentUser)
+	p.tokenService.SetAccessTokenDenylist(p.store)
+	p.answerUsers = newAnswerUserService(p.config.AnswerAPIURL())
+	p.authorizeHandler = oidc.NewAuthorizeHandler(p.store, p.config, p.tokenService, p.resolveCurrentUser)
+	p.authorizeHandler.SetSessionTerminator(p.endAnswerSession)
 	p.tokenHandler = oidc.NewTokenHandler(p.store, p.tokenService)
 	p.metadataHandler = oidc.NewMetadataHandler(p.config, p.keyService)
-	p.userinfoHandler = oidc.NewUserInfoHandler(p.tokenService, p.resolveUserByID)
-	p.revokeHandler = oidc.NewRevokeHandler(p.store)
-	p.adminHandler = oidc.NewAdminClientHandler(p.store)
+	p.userinfoHandler = oidc.NewUserInfoHandler(p.store, p.tokenService, p.resolveUserByID)
+	p.revokeHandler = oidc.NewRevokeHandler(p.store, p.tokenService)
+	p.introspectHandler = oidc.NewIntrospectHandler(p.store, p.tokenService)
+	p.adminHandler = oidc.NewAdminClientHandler(p.store, p.config)
+	p.adminEventHandler = oidc.NewAdminEventHandler(p.store)
+	p.adminResourceHandler = oidc.NewAdminResourceHandler(p.store)
+	p.adminDetailHandler = oidc.NewAdminDetailTypeHandler(p.store)
+	p.connectedAppsHandler = oidc.NewConnectedAppsHandler(p.store, p.resolveCurrentUser)
+	p.backchannelHandler = oidc.NewBackchannelHandler(p.store, p.tokenService, p.resolveUserByHint, p.resolveCurrentUser)
 	return nil
 }
 
@@ -241,38 +465,60 @@ func (p *OIDCProviderPlugin) resolveCurrentUser(ctx oidc.HTTPContext) (oidc.User
 	if !ok {
 		return oidc.UserProfile{}, errors.New("no login user")
 	}
+	account, err := p.currentAnswerUsers().currentUser(ctx)
+	if err != nil || account.ID != user.ID {
+		return oidc.UserProfile{}, errors.New("no login user")
+	}
+	user = account.profile(user)
+	store := p.currentStore()
+	if known, err := store.FindKnownUser(user.ID); err != nil || known.Username != user.Username || known.Email != user.Email {
+		_ = store.SaveKnownUser(oidc.KnownUserRecord{UserID: user.ID, Username: user.Username, Email: user.Email})
+	}
+	return user, nil
+}
+
+func (p *OIDCProviderPlugin) endAnswerSession(ctx oidc.HTTPContext) error {
+	return p.currentAnswerUsers().logout(ctx)
+}
+
+func (p *OIDCProviderPlugin) resolveUserByID(userID string) (oidc.UserProfile, error) {
+	known, err := p.currentStore().FindKnownUser(userID)
+	if err != nil || known.UserID != userID {
+		return oidc.UserProfile{}, errors.New("user not found")
+	}
+	return p.lookupKnownUser(known)
+}
 
-	p.usersMu.Lock()
-	defer p.usersMu.Unlock()
-	if existing, hit := p.users[user.ID]; hit {
-		if user.Username == "" {
-			user.Username = existing.Username
-		}
-		if user.Email == "" {
-			user.Email = existing.Email
-		}
-		if user.Name == "" {
-			user.Name = existing.Name
+func (p *OIDCProviderPlugin) resolveUserByHint(hint string) (oidc.UserProfile, error) {
+	if account, err := p.currentAnswerUsers().userByUsername(hint); err == nil {
+		profile := account.profile(oidc.UserProfile{})
+		if known, err := p.currentStore().FindKnownUser(account.ID); err == nil {
+			profile.Email = known.Email
 		}
+		return profile, nil
 	}
-	if user.Username == "" {
-		user.Username = user.ID
+	store := p.currentStore()
+	known, err := store.FindKnownUser(hint)
+	if err == nil && known.UserID != hint {
+		known, err = store.FindKnownUser(known.UserID)
+		if err == nil && !strings.EqualFold(known.Email, hint) {
+			err = errors.New("email changed")
+		}
 	}
-	if user.Name == "" {
-		user.Name = user.Username
+	if err != nil {
+		return oidc.UserProfile{}, errors.New("user not found")
 	}
-	p.users[user.ID] = user
-	return user, nil
+	return p.lookupKnownUser(known)
 }
 
-func (p *OIDCProviderPlugin) resolveUserByID(userID string) (oidc.UserProfile, error) {
-	p.usersMu.RLock()
-	defer p.usersMu.RUnlock()
-	user, ok := p.users[userID]
-	if !ok {
+func (p *OIDCProviderPlugin) lookupKnownUser(known oidc.KnownUserRecord) (oidc.UserProfile, error) {
+	account, err := p.currentAnswerUsers().userByUsername(known.Username)
+	if err != nil || account.ID != known.UserID {
 		return oidc.UserProfile{}, errors.New("user not found")
 	}
-	return user, nil
+	profile := account.profile(oidc.UserProfile{})
+	profile.Email = known.Email
+	return profile, nil
 }
 
 func (p *OIDCProviderPlugin) wrapHTTPContext(handler func(ctx oidc.HTTPContext)) gin.HandlerFunc {
@@ -297,6 +543,18 @@ func (p *OIDCProviderPlugin) HealthHandler() gin.HandlerFunc {
 	}
 }
 
+func (p *OIDCProviderPlugin) currentStore() oidc.Store {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.store
+}
+
+func (p *OIDCProviderPlugin) currentAnswerUsers() *answerUserService {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.answerUsers
+}
+
 func (p *OIDCProviderPlugin) currentAuthorizeHandler() *oidc.AuthorizeHandler {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -327,6 +585,42 @@ func (p *OIDCProviderPlugin) currentRevokeHandler() *oidc.RevokeHandler {
 	return p.revokeHandler
 }
 
+func (p *OIDCProviderPlugin) currentIntrospectHandler() *oidc.IntrospectHandler {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.introspectHandler
+}
+
+func (p *OIDCProviderPlugin) currentAdminEventHandler() *oidc.AdminEventHandler {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.adminEventHandler
+}
+
+func (p *OIDCProviderPlugin) currentConnectedAppsHandler() *oidc.ConnectedAppsHandler {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.connectedAppsHandler
+}
+
+func (p *OIDCProviderPlugin) currentAdminResourceHandler() *oidc.AdminResourceHandler {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.adminResourceHandler
+}
+
+func (p *OIDCProviderPlugin) currentBackchannelHandler() *oidc.BackchannelHandler {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.backchannelHandler
+}
+
+func (p *OIDCProviderPlugin) currentAdminDetailHandler() *oidc.AdminDetailTypeHandler {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.adminDetailHandler
+}
+
 func (p *OIDCProviderPlugin) currentAdminHandler() *oidc.AdminClientHandler {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -3,7 +3,12 @@ package oidcprovider_test
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	answerplugin "github.com/apache/answer/plugin"
 	"github.com/gin-gonic/gin"
@@ -72,6 +77,7 @@ func TestRouteRegistration(t *testing.T) {
 
 	instance.RegisterUnAuthRouter(apiV1)
 	instance.RegisterAuthAdminRouter(adminAPI)
+	instance.RegisterAuthUserRouter(apiV1)
 
 	allRoutes := engine.Routes()
 	if len(allRoutes) == 0 {
@@ -87,3 +93,213 @@ func getFieldValue(fields []answerplugin.ConfigField, name string) (string, bool
 	}
 	return "", false
 }
+
+func newIssuerModeEngine(t *testing.T, prefix, mode string) *gin.Engine {
+	t.Helper()
+	instance := oidcprovider.NewOIDCProviderPlugin()
+	if err := instance.ConfigReceiver([]byte(`{"issuer_mode":"` + mode + `"}`)); err != nil {
+		t.Fatalf("config receiver: %v", err)
+	}
+	engine := gin.New()
+	instance.RegisterUnAuthRouter(engine.Group(prefix))
+	return engine
+}
+
+func TestDiscoveryIssuerMatchesServedLocation(t *testing.T) {
+	for _, prefix := range []string{"/answer/api/v1", "/forum/answer/api/v1"} {
+		for mode, issuerPath := range map[string]string{
+			"root":      "",
+			"base_path": prefix + "/api/auth/oidc",
+		} {
+			engine := newIssuerModeEngine(t, prefix, mode)
+
+			location := issuerPath + "/.well-known/openid-configuration"
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, location, nil))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("%s %s: expected 200, got %d", mode, location, recorder.Code)
+			}
+			body := map[string]any{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode discovery: %v", err)
+			}
+			if issuer, _ := body["issuer"].(string); issuer != "http://localhost:8080"+issuerPath {
+				t.Fatalf("%s: discovery issuer %q does not match served location %q", mode, issuer, location)
+			}
+			if body["token_endpoint"] != "http://localhost:8080"+prefix+"/api/auth/oidc/token" {
+				t.Fatalf("%s: unexpected token endpoint %v", mode, body["token_endpoint"])
+			}
+		}
+	}
+}
+
+func newFakeAnswerAPI(t *testing.T, lastLogin *time.Time, logouts *int) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/answer/api/v1/user/info", func(w http.ResponseWriter, r *http.Request) {
+		data := any(nil)
+		if r.Header.Get("Authorization") == "tok_1" {
+			data = map[string]any{"id": "u_1", "username": "john", "e_mail": "john@example.com", "last_login_date": lastLogin.Unix()}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"code": 200, "data": data})
+	})
+	mux.HandleFunc("/answer/api/v1/personal/user/info", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("username") != "john" {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]any{"code": 404})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"code": 200, "data": map[string]any{"id": "u_1", "username": "john", "display_name": "John"}})
+	})
+	mux.HandleFunc("/answer/api/v1/user/logout", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "tok_1" {
+			*logouts++
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"code": 200})
+	})
+	server := httptest.NewServer(mux)
+	answerplugin.RegisterGetSiteURLFunc(func() string { return server.URL })
+	t.Cleanup(func() {
+		answerplugin.RegisterGetSiteURLFunc(nil)
+		server.Close()
+	})
+	return server
+}
+
+func TestAuthorizeUsesAnswerLoginTime(t *testing.T) {
+	lastLogin := time.Now().Add(-time.Hour)
+	logouts := 0
+	newFakeAnswerAPI(t, &lastLogin, &logouts)
+
+	instance := oidcprovider.NewOIDCProviderPlugin()
+	engine := gin.New()
+	engine.Use(func(ctx *gin.Context) {
+		ctx.Set("ctxUuidKey", &fakeAnswerUser{UserID: "u_1"})
+	})
+	instance.RegisterUnAuthRouter(engine.Group("/answer/api/v1"))
+	instance.RegisterAuthAdminRouter(engine.Group("/answer/admin/api"))
+
+	create := httptest.NewRequest(http.MethodPost, "/answer/admin/api/api/auth/oidc/admin/clients", strings.NewReader(`{"id":"client_1","name":"client","redirect_uris":["https://client.example.com/callback"],"scopes":["openid"],"grant_types":["authorization_code"],"token_endpoint_auth_method":"client_secret_post"}`))
+	create.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, create)
+	if recorder.Code != http.StatusCreated && recorder.Code != http.StatusOK {
+		t.Fatalf("create client: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	authorize := func(extra string) *url.URL {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodGet, "/answer/api/v1/api/auth/oidc/authorize?response_type=code&client_id=client_1&redirect_uri=https%3A%2F%2Fclient.example.com%2Fcallback&scope=openid&state=s&code_challenge=E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM&code_challenge_method=S256"+extra, nil)
+		request.Header.Set("Authorization", "Bearer tok_1")
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusFound {
+			t.Fatalf("authorize%s: expected redirect, got %d %s", extra, recorder.Code, recorder.Body.String())
+		}
+		location, err := url.Parse(recorder.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("parse location: %v", err)
+		}
+		return location
+	}
+
+	if location := authorize("&max_age=60"); !strings.HasPrefix(location.Path, "/users/login") {
+		t.Fatalf("expected login redirect for an old Answer login, got %s", location)
+	}
+	lastLogin = time.Now()
+	if location := authorize("&max_age=60"); location.Query().Get("code") == "" {
+		t.Fatalf("expected code for a fresh Answer login, got %s", location)
+	}
+
+	logouts = 0
+	if location := authorize("&prompt=login"); !strings.HasPrefix(location.Path, "/users/login") || logouts != 1 {
+		t.Fatalf("expected prompt=login to end the Answer session, got %s logouts=%d", location, logouts)
+	}
+}
+
+func TestBackchannelHintsResolveThroughAnswer(t *testing.T) {
+	lastLogin := time.Now()
+	logouts := 0
+	newFakeAnswerAPI(t, &lastLogin, &logouts)
+
+	instance := oidcprovider.NewOIDCProviderPlugin()
+	engine := gin.New()
+	engine.Use(func(ctx *gin.Context) {
+		ctx.Set("ctxUuidKey", &fakeAnswerUser{UserID: "u_1"})
+	})
+	instance.RegisterUnAuthRouter(engine.Group("/answer/api/v1"))
+	instance.RegisterAuthUserRouter(engine.Group("/answer/api/v1"))
+	instance.RegisterAuthAdminRouter(engine.Group("/answer/admin/api"))
+
+	create := httptest.NewRequest(http.MethodPost, "/answer/admin/api/api/auth/oidc/admin/clients", strings.NewReader(`{"id":"kiosk","name":"kiosk","secret":"secret_1","scopes":["openid"],"grant_types":["urn:openid:params:grant-type:ciba"],"token_endpoint_auth_method":"client_secret_post"}`))
+	create.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, create)
+	if recorder.Code != http.StatusCreated && recorder.Code != http.StatusOK {
+		t.Fatalf("create client: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	authenticate := func(hint string) int {
+		t.Helper()
+		form := url.Values{"client_id": {"kiosk"}, "client_secret": {"secret_1"}, "scope": {"openid"}, "login_hint": {hint}}
+		request := httptest.NewRequest(http.MethodPost, "/answer/api/v1/api/auth/oidc/bc-authorize", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	if code := authenticate("john"); code != http.StatusOK {
+		t.Fatalf("username hint should resolve through Answer, got %d", code)
+	}
+	if code := authenticate("u_1"); code != http.StatusBadRequest {
+		t.Fatalf("an unseen user ID cannot be resolved, got %d", code)
+	}
+
+	page := httptest.NewRequest(http.MethodGet, "/answer/api/v1/api/auth/oidc/backchannel", nil)
+	page.Header.Set("Authorization", "Bearer tok_1")
+	recorder = httptest.NewRecorder()
+	engine.ServeHTTP(recorder, page)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("pending page: %d %s", recorder.Code, recorder.Body.String())
+	}
+	for _, hint := range []string{"u_1", "JOHN@example.com"} {
+		if code := authenticate(hint); code != http.StatusOK {
+			t.Fatalf("hint %q should resolve after the user signed in, got %d", hint, code)
+		}
+	}
+}
+
+func TestWellKnownDocumentsAtRFCLocations(t *testing.T) {
+	for _, prefix := range []string{"/answer/api/v1", "/forum/answer/api/v1"} {
+		for mode, issuerPath := range map[string]string{
+			"root":      "",
+			"base_path": prefix + "/api/auth/oidc",
+		} {
+			engine := newIssuerModeEngine(t, prefix, mode)
+
+			servedPath := prefix + "/api/auth/oidc"
+			for location, want := range map[string]int{
+				"/.well-known/oauth-authorization-server" + issuerPath:                        http.StatusOK,
+				"/.well-known/oauth-authorization-server/other":                               http.StatusNotFound,
+				"/.well-known/webfinger?resource=acct%3Ajohn%40localhost%3A8080":              http.StatusOK,
+				servedPath + "/.well-known/webfinger?resource=acct%3Ajohn%40localhost%3A8080": http.StatusOK,
+			} {
+				recorder := httptest.NewRecorder()
+				engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, location, nil))
+				if recorder.Code != want {
+					t.Fatalf("%s %s: expected %d, got %d %s", mode, location, want, recorder.Code, recorder.Body.String())
+				}
+				if want != http.StatusOK {
+					continue
+				}
+				body := map[string]any{}
+				if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+					t.Fatalf("%s: decode: %v", location, err)
+				}
+				if strings.Contains(location, "oauth-authorization-server") && body["issuer"] != "http://localhost:8080"+issuerPath {
+					t.Fatalf("%s %s: unexpected issuer %v", mode, location, body["issuer"])
+				}
+			}
+		}
+	}
+}